@@ -0,0 +1,65 @@
+package classifier
+
+import (
+	"log"
+	"server/config"
+	"server/utils"
+	"sort"
+)
+
+const (
+	maxLabels           = 10   // Per image
+	minStoredConfidence = 0.05 // Labels below that are ignored
+	maxLabelLength      = 100  // Longer names are truncated to fit the column
+)
+
+// Label is a semantic label for an image, e.g. "beach", with confidence between 0 and 1
+type Label struct {
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Classifier returns labels for the image at the given path
+type Classifier interface {
+	Classify(imgPath string) ([]Label, error)
+}
+
+// Default is the configured classifier, nil if image classification is disabled
+var Default Classifier
+
+func Init() {
+	if config.CLASSIFIER_COMMAND == "" {
+		log.Println("Image classification is disabled")
+		return
+	}
+	Default = &Command{Path: config.CLASSIFIER_COMMAND, Model: config.CLASSIFIER_MODEL}
+}
+
+// Classify uses the default classifier and keeps the most confident labels only
+func Classify(imgPath string) ([]Label, error) {
+	labels, err := Default.Classify(imgPath)
+	if err != nil {
+		return nil, err
+	}
+	return topLabels(labels), nil
+}
+
+func topLabels(labels []Label) []Label {
+	result := []Label{}
+	seen := map[string]bool{}
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].Confidence > labels[j].Confidence
+	})
+	for _, l := range labels {
+		l.Name = utils.TruncateString(l.Name, maxLabelLength)
+		if l.Name == "" || l.Confidence < minStoredConfidence || seen[l.Name] {
+			continue
+		}
+		seen[l.Name] = true
+		result = append(result, l)
+		if len(result) == maxLabels {
+			break
+		}
+	}
+	return result
+}
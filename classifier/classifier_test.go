@@ -0,0 +1,37 @@
+package classifier
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	Default = &Stub{Labels: []Label{
+		{"snow", 0.2},
+		{"dog", 0.9},
+		{"noise", 0.01},
+		{"dog", 0.5},
+		{"", 0.8},
+		{strings.Repeat("long", 30), 0.3},
+	}}
+	defer func() { Default = nil }()
+	got, err := Classify("any.jpg")
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	want := []Label{{"dog", 0.9}, {strings.Repeat("long", 25), 0.3}, {"snow", 0.2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Classify() = %v, want %v", got, want)
+	}
+}
+
+func Test_parseLabels(t *testing.T) {
+	got, err := parseLabels([]byte(`[{"name": " Beach ", "confidence": 0.75}]`))
+	if err != nil || len(got) != 1 || got[0].Name != "beach" || got[0].Confidence != 0.75 {
+		t.Errorf("parseLabels() = %v, %v", got, err)
+	}
+	if _, err = parseLabels([]byte("beach 0.75")); err == nil {
+		t.Errorf("parseLabels() expected error")
+	}
+}
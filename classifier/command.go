@@ -0,0 +1,48 @@
+package classifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	commandTimeout = time.Minute
+)
+
+// Command runs a local (CPU-only) helper binary, e.g. a MobileNet model wrapped with ONNX Runtime or TFLite.
+// It's called as "<path> [model] <image>" and must print a JSON array of labels, e.g. [{"name":"dog","confidence":0.92}]
+type Command struct {
+	Path  string
+	Model string // Optional, passed as the first argument
+}
+
+func (c *Command) Classify(imgPath string) ([]Label, error) {
+	log.Printf("Classifying %s", imgPath)
+	args := []string{}
+	if c.Model != "" {
+		args = append(args, c.Model)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, c.Path, append(args, imgPath)...).Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseLabels(output)
+}
+
+func parseLabels(output []byte) ([]Label, error) {
+	labels := []Label{}
+	if err := json.Unmarshal(output, &labels); err != nil {
+		return nil, fmt.Errorf("invalid classifier output: %w", err)
+	}
+	for i := range labels {
+		labels[i].Name = strings.ToLower(strings.TrimSpace(labels[i].Name))
+	}
+	return labels, nil
+}
@@ -0,0 +1,11 @@
+package classifier
+
+// Stub returns the same labels for every image, it's used in tests
+type Stub struct {
+	Labels []Label
+	Err    error
+}
+
+func (s *Stub) Classify(imgPath string) ([]Label, error) {
+	return s.Labels, s.Err
+}
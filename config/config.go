@@ -16,10 +16,27 @@ var (
 	TMP_DIR                    = "/tmp" // Used for temporary video conversion, etc (in case of S3 bucket)
 	DEFAULT_BUCKET_DIR         = ""     // Used for creating initial bucket
 	GAODE_API_KEY              = ""     // Gaode Maps API key, optional
+	GEOCODER                   = ""     // Reverse geocoding: "nominatim", "photon", "gaode" or "offline". Gaode if GAODE_API_KEY is set, Nominatim otherwise
+	GEOCODER_LANGUAGE          = "en"   // Preferred language of location names (not used by Gaode)
+	GEOCODER_INTERVAL          = 3.0    // Minimum seconds between requests to online geocoders
+	GEONAMES_DIR               = ""     // GeoNames files for the offline geocoder (also used as fallback when set)
+	GEO_BOUNDARIES_FILE        = ""     // Country boundaries GeoJSON (e.g. Natural Earth) for the offline geocoder, optional
+	NOMINATIM_URL              = "https://nominatim.openstreetmap.org"
+	PHOTON_URL                 = "https://photon.komoot.io"
 	DEBUG_MODE                 = true
-	FACE_DETECT                = true  // Enable/disable face detection
-	FACE_DETECT_CNN            = false // Use Convolutional Neural Network for face detection (as opposed to HOG). Much slower, supposedly more accurate at different angles
-	FACE_MAX_DISTANCE_SQ       = 0.11  // Squared distance between faces to consider them similar
+	FACE_DETECT                = true    // Enable/disable face detection
+	FACE_DETECT_CNN            = false   // Use Convolutional Neural Network for face detection (as opposed to HOG). Much slower, supposedly more accurate at different angles
+	FACE_DETECT_BACKEND        = "local" // "local" (go-face, needs CGO and dlib) or "http"
+	FACE_DETECT_URL            = ""      // Face detection service URL, for the "http" backend
+	FACE_MAX_DISTANCE_SQ       = 0.11    // Squared distance between faces to consider them similar
+	BEST_OF_MIN_SCORE          = 0.6     // Minimum quality score (0 to 1) for an asset to be included in the "best of" filter
+	OCR_ENABLED                = false   // Extract text from images using tesseract
+	OCR_LANGUAGES              = "eng"   // Tesseract languages, e.g. "eng+deu"
+	CLASSIFIER_COMMAND         = ""      // Local image classification helper binary, disabled if empty
+	CLASSIFIER_MODEL           = ""      // Model file passed to the classification helper, optional
+	LABEL_MIN_CONFIDENCE       = 0.5     // Minimum confidence (0 to 1) for image labels to be returned as tags
+	RAW_JPEG_PAIRING           = false   // Show RAW+JPEG shots as one asset (the JPEG), hiding the RAW file from listings
+	METADATA_WRITEBACK         = ""      // Write corrected metadata back to the files: "original" or "sidecar" (XMP), disabled if empty
 	// TURN server support is better be enabled if you are planning to use the video/audio call functionalities.
 	// By default a public STUN server would be added, but in cases where NAT firewall rules are too strict (symmetric NATs, etc), a TURN server is needed to relay the traffic
 	TURN_SERVER_IP        = ""   // If configured, Pion TURN server would be started locally and this value used to advertise ourselves. Should be your public IP. Defaults to empty string.
@@ -37,11 +54,28 @@ func init() {
 	readEnvString("TMP_DIR", &TMP_DIR)
 	readEnvString("DEFAULT_BUCKET_DIR", &DEFAULT_BUCKET_DIR)
 	readEnvString("GAODE_API_KEY", &GAODE_API_KEY)
+	readEnvString("GEOCODER", &GEOCODER)
+	readEnvString("GEOCODER_LANGUAGE", &GEOCODER_LANGUAGE)
+	readEnvFloat("GEOCODER_INTERVAL", &GEOCODER_INTERVAL)
+	readEnvString("NOMINATIM_URL", &NOMINATIM_URL)
+	readEnvString("PHOTON_URL", &PHOTON_URL)
+	readEnvString("GEONAMES_DIR", &GEONAMES_DIR)
+	readEnvString("GEO_BOUNDARIES_FILE", &GEO_BOUNDARIES_FILE)
 	readEnvString("DEFAULT_ASSET_PATH_PATTERN", &DEFAULT_ASSET_PATH_PATTERN)
 	readEnvBool("DEBUG_MODE", &DEBUG_MODE)
 	readEnvBool("FACE_DETECT", &FACE_DETECT)
 	readEnvBool("FACE_DETECT_CNN", &FACE_DETECT_CNN)
+	readEnvString("FACE_DETECT_BACKEND", &FACE_DETECT_BACKEND)
+	readEnvString("FACE_DETECT_URL", &FACE_DETECT_URL)
 	readEnvFloat("FACE_MAX_DISTANCE_SQ", &FACE_MAX_DISTANCE_SQ)
+	readEnvFloat("BEST_OF_MIN_SCORE", &BEST_OF_MIN_SCORE)
+	readEnvBool("OCR_ENABLED", &OCR_ENABLED)
+	readEnvString("OCR_LANGUAGES", &OCR_LANGUAGES)
+	readEnvString("CLASSIFIER_COMMAND", &CLASSIFIER_COMMAND)
+	readEnvString("CLASSIFIER_MODEL", &CLASSIFIER_MODEL)
+	readEnvFloat("LABEL_MIN_CONFIDENCE", &LABEL_MIN_CONFIDENCE)
+	readEnvBool("RAW_JPEG_PAIRING", &RAW_JPEG_PAIRING)
+	readEnvString("METADATA_WRITEBACK", &METADATA_WRITEBACK)
 	readEnvString("TURN_SERVER_IP", &TURN_SERVER_IP)
 	readEnvInt("TURN_SERVER_PORT", &TURN_SERVER_PORT)
 	readEnvInt("TURN_TRAFFIC_MIN_PORT", &TURN_TRAFFIC_MIN_PORT)
@@ -3,13 +3,21 @@ package db
 import (
 	"log"
 	"server/config"
+	"strings"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+const (
+	// Escape character for EscapeLike patterns, use as: "column like ? escape '!'" (a backslash is not portable between MySQL and SQLite)
+	LikeEscape = "escape '!'"
+)
+
 var (
+	likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
 	Instance        *gorm.DB
 	TimestampFunc   = ""
 	CreatedDateFunc = ""
@@ -41,3 +49,8 @@ func Init() {
 	}
 	Instance = db
 }
+
+// EscapeLike escapes the wildcards in user input used in a LIKE pattern (with LikeEscape)
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,75 @@
+package faces
+
+import (
+	"math/rand"
+	"server/utils"
+	"sort"
+)
+
+const (
+	clusterIterations = 20
+	clusterSeed       = 1 // Fixed, so the same faces always give the same clusters
+)
+
+// Cluster groups similar face descriptors using the Chinese whispers algorithm.
+// Faces closer than maxDistanceSq are connected and each face then repeatedly takes the most common label among its neighbours.
+// Returns the groups (indexes in descriptors) with at least minSize faces, largest first
+func Cluster(descriptors [][]float32, maxDistanceSq float64, minSize int) [][]int {
+	n := len(descriptors)
+	neighbours := make([][]int, n)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if utils.DistanceSq(descriptors[i], descriptors[j]) <= maxDistanceSq {
+				neighbours[i] = append(neighbours[i], j)
+				neighbours[j] = append(neighbours[j], i)
+			}
+		}
+	}
+	labels := make([]int, n)
+	for i := range labels {
+		labels[i] = i
+	}
+	random := rand.New(rand.NewSource(clusterSeed))
+	for iteration := 0; iteration < clusterIterations; iteration++ {
+		changed := false
+		for _, i := range random.Perm(n) {
+			if len(neighbours[i]) == 0 {
+				continue
+			}
+			counts := map[int]int{}
+			best, bestCount := labels[i], 0
+			for _, j := range neighbours[i] {
+				label := labels[j]
+				counts[label]++
+				// Ties go to the lower label, to be deterministic
+				if counts[label] > bestCount || (counts[label] == bestCount && label < best) {
+					best, bestCount = label, counts[label]
+				}
+			}
+			if best != labels[i] {
+				labels[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	groups := map[int][]int{}
+	for i, label := range labels {
+		groups[label] = append(groups[label], i)
+	}
+	result := [][]int{}
+	for _, group := range groups {
+		if len(group) >= minSize {
+			result = append(result, group)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i]) != len(result[j]) {
+			return len(result[i]) > len(result[j])
+		}
+		return result[i][0] < result[j][0]
+	})
+	return result
+}
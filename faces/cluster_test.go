@@ -0,0 +1,45 @@
+package faces
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestCluster(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	centre := func(value float32) []float32 {
+		result := make([]float32, 128)
+		for i := range result {
+			result[i] = value
+		}
+		return result
+	}
+	near := func(c []float32) []float32 {
+		result := make([]float32, len(c))
+		for i := range c {
+			result[i] = c[i] + (random.Float32()-0.5)*0.02
+		}
+		return result
+	}
+	// Two people (5 and 3 faces) and one face on its own, mixed
+	a, b, other := centre(0), centre(0.2), centre(-0.3)
+	descriptors := [][]float32{near(a), near(b), near(a), near(other), near(a), near(b), near(a), near(b), near(a)}
+
+	tests := []struct {
+		minSize int
+		want    [][]int
+	}{
+		{1, [][]int{{0, 2, 4, 6, 8}, {1, 5, 7}, {3}}},
+		{3, [][]int{{0, 2, 4, 6, 8}, {1, 5, 7}}},
+		{4, [][]int{{0, 2, 4, 6, 8}}},
+	}
+	for _, tt := range tests {
+		if got := Cluster(descriptors, 0.11, tt.minSize); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Cluster(minSize=%d) = %v, want %v", tt.minSize, got, tt.want)
+		}
+	}
+	if got := Cluster(nil, 0.11, 1); len(got) != 0 {
+		t.Errorf("Cluster(nil) = %v, want no clusters", got)
+	}
+}
@@ -1,39 +1,87 @@
 package faces
 
 import (
+	"errors"
+	"image"
 	"log"
-	"path/filepath"
 	"server/config"
-
-	"github.com/Kagami/go-face"
 )
 
-var (
-	modelsDir = filepath.Join(".", "models")
-	rec       *face.Recognizer
+const (
+	MaxUpsample    = 2
+	DescriptorSize = 128
+
+	BackendLocal = "local" // In-process go-face (dlib), needs CGO
+	BackendHTTP  = "http"  // Separate detection service, see HTTP
 )
 
-func init() {
+// Face is a detected face: its location in the image and its 128-dimensional descriptor
+type Face struct {
+	Rectangle  image.Rectangle
+	Descriptor []float32
+}
+
+// Options can be used to find more (e.g. smaller or turned) faces at the cost of speed
+type Options struct {
+	CNN      bool // Convolutional Neural Network based detection instead of HOG
+	Upsample int  // Number of times to double the image size before detection, to find small faces
+	MinSize  int  // Minimum face width and height in pixels, smaller faces are ignored
+}
+
+// Detector returns the faces found in the image at the given path
+type Detector interface {
+	Detect(imgPath string, opts Options) ([]Face, error)
+}
+
+// Default is the configured detector, nil if face detection is disabled
+var Default Detector
+
+func Init() {
 	if !config.FACE_DETECT {
 		log.Println("Face detection is disabled")
 		return
 	}
-	log.Println("Loading face recognition models...")
-	// Init the recognizer.
-	var err error
-	rec, err = face.NewRecognizer(modelsDir)
+	switch config.FACE_DETECT_BACKEND {
+	case BackendLocal:
+		log.Println("Loading face recognition models...")
+		detector, err := newLocal()
+		if err != nil {
+			log.Fatalf("Can't init face recognizer: %v", err)
+		}
+		Default = detector
+	case BackendHTTP:
+		if config.FACE_DETECT_URL == "" {
+			log.Fatal("FACE_DETECT_URL is needed for the http face detection backend")
+		}
+		Default = NewHTTP(config.FACE_DETECT_URL)
+	default:
+		log.Fatalf("Unknown face detection backend: %s", config.FACE_DETECT_BACKEND)
+	}
+}
+
+// DefaultOptions returns the configured options
+func DefaultOptions() Options {
+	return Options{CNN: config.FACE_DETECT_CNN}
+}
+
+func Detect(imgPath string, opts Options) ([]Face, error) {
+	if Default == nil {
+		return nil, errors.New("face detection is not initialized")
+	}
+	log.Printf("Detecting faces in %s (%+v)", imgPath, opts)
+	found, err := Default.Detect(imgPath, opts)
 	if err != nil {
-		log.Fatalf("Can't init face recognizer: %v", err)
+		return nil, err
 	}
+	return filterSmall(found, opts.MinSize), nil
 }
 
-func Detect(imgPath string) ([]face.Face, error) {
-	log.Printf("Detecting faces in %s", imgPath)
-	// Recognize faces on that image.
-	if !config.FACE_DETECT_CNN {
-		// HOG (Histogram of Oriented Gradients) based detection
-		return rec.RecognizeFile(imgPath)
+func filterSmall(found []Face, minSize int) []Face {
+	result := make([]Face, 0, len(found))
+	for _, f := range found {
+		if f.Rectangle.Dx() >= minSize && f.Rectangle.Dy() >= minSize {
+			result = append(result, f)
+		}
 	}
-	// CNN (Convolutional Neural Network) based detection
-	return rec.RecognizeFileCNN(imgPath)
+	return result
 }
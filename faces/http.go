@@ -0,0 +1,63 @@
+package faces
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	httpTimeout = 2 * time.Minute // CNN detection on a slow CPU can take a while
+)
+
+// HTTP posts the image (as the request body) to a face detection service, e.g. one based on the face_recognition Python library.
+// The options are sent as "model" (hog or cnn) and "upsample" query parameters.
+// The service must respond with FaceDetectionResult JSON, locations are [top, right, bottom, left]
+type HTTP struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewHTTP(url string) *HTTP {
+	return &HTTP{URL: url, Client: &http.Client{Timeout: httpTimeout}}
+}
+
+func (h *HTTP) Detect(imgPath string, opts Options) ([]Face, error) {
+	file, err := os.Open(imgPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("model", "hog")
+	if opts.CNN {
+		query.Set("model", "cnn")
+	}
+	query.Set("upsample", strconv.Itoa(min(max(opts.Upsample, 0), MaxUpsample)))
+	u.RawQuery = query.Encode()
+	response, err := h.Client.Post(u.String(), "image/jpeg", file)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("face detection service error: %s", response.Status)
+	}
+	result, err := toFacesResult(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid face detection response: %w", err)
+	}
+	return result.toFaces()
+}
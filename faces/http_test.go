@@ -0,0 +1,90 @@
+package faces
+
+import (
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTTPDetect(t *testing.T) {
+	imgPath := filepath.Join(t.TempDir(), "thumb.jpg")
+	if err := os.WriteFile(imgPath, []byte("jpeg data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	encoding := "[0.5" + strings.Repeat(",0.25", 127) + "]"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || string(body) != "jpeg data" || r.URL.Query().Get("model") != "cnn" || r.URL.Query().Get("upsample") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"locations": [[10, 120, 110, 20]], "encodings": [`+encoding+`]}`)
+	}))
+	defer server.Close()
+
+	got, err := NewHTTP(server.URL).Detect(imgPath, Options{CNN: true, Upsample: 1})
+	if err != nil {
+		t.Fatalf("Detect() error = %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("Detect() = %d faces, want 1", len(got))
+	}
+	if want := image.Rect(20, 10, 120, 110); got[0].Rectangle != want {
+		t.Errorf("Rectangle = %v, want %v", got[0].Rectangle, want)
+	}
+	if d := got[0].Descriptor; len(d) != 128 || d[0] != 0.5 || d[127] != 0.25 {
+		t.Errorf("Descriptor = %v", d)
+	}
+
+	if _, err = NewHTTP(server.URL).Detect(filepath.Join(t.TempDir(), "missing.jpg"), Options{}); err == nil {
+		t.Error("Detect() expected error for a missing file")
+	}
+}
+
+func TestHTTPDetectErrors(t *testing.T) {
+	imgPath := filepath.Join(t.TempDir(), "thumb.jpg")
+	if err := os.WriteFile(imgPath, []byte("jpeg data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"server error", http.StatusInternalServerError, `{"locations": [], "encodings": []}`},
+		{"invalid json", http.StatusOK, `faces`},
+		{"mismatched lengths", http.StatusOK, `{"locations": [[1, 2, 3, 4]], "encodings": []}`},
+		{"short encoding", http.StatusOK, `{"locations": [[1, 2, 3, 4]], "encodings": [[0.1, 0.2]]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+			if _, err := NewHTTP(server.URL).Detect(imgPath, Options{}); err == nil {
+				t.Error("Detect() expected error")
+			}
+		})
+	}
+}
+
+func TestFilterSmall(t *testing.T) {
+	found := []Face{
+		{Rectangle: image.Rect(0, 0, 40, 40)},
+		{Rectangle: image.Rect(0, 0, 19, 40)},
+		{Rectangle: image.Rect(10, 10, 30, 30)},
+	}
+	if got := filterSmall(found, 20); len(got) != 2 || got[1].Rectangle.Min.X != 10 {
+		t.Errorf("filterSmall() = %v", got)
+	}
+	if got := filterSmall(found, 0); len(got) != 3 {
+		t.Errorf("filterSmall() with no minimum = %v", got)
+	}
+}
@@ -0,0 +1,90 @@
+//go:build cgo && !nogoface
+
+package faces
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"server/config"
+	"server/utils"
+
+	"github.com/Kagami/go-face"
+	"github.com/nfnt/resize"
+)
+
+var (
+	modelsDir = filepath.Join(".", "models")
+)
+
+// Local detects faces in-process with go-face (dlib)
+type Local struct {
+	rec *face.Recognizer
+}
+
+func newLocal() (Detector, error) {
+	rec, err := face.NewRecognizer(modelsDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Local{rec: rec}, nil
+}
+
+func (l *Local) Detect(imgPath string, opts Options) ([]Face, error) {
+	scale := 1 << min(max(opts.Upsample, 0), MaxUpsample)
+	if scale > 1 {
+		upsampled, err := upsampleImage(imgPath, scale)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(upsampled)
+		imgPath = upsampled
+	}
+	var found []face.Face
+	var err error
+	// Recognize faces on that image.
+	if !opts.CNN {
+		// HOG (Histogram of Oriented Gradients) based detection
+		found, err = l.rec.RecognizeFile(imgPath)
+	} else {
+		// CNN (Convolutional Neural Network) based detection
+		found, err = l.rec.RecognizeFileCNN(imgPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Face, 0, len(found))
+	for _, f := range found {
+		r := f.Rectangle
+		result = append(result, Face{
+			Rectangle:  image.Rect(r.Min.X/scale, r.Min.Y/scale, r.Max.X/scale, r.Max.Y/scale),
+			Descriptor: f.Descriptor[:],
+		})
+	}
+	return result, nil
+}
+
+// upsampleImage saves a bigger copy of the image to a temporary file
+func upsampleImage(imgPath string, scale int) (string, error) {
+	file, err := os.Open(imgPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	img, _, err := utils.DecodeImage(file)
+	if err != nil {
+		return "", err
+	}
+	bounds := img.Bounds()
+	img = resize.Resize(uint(bounds.Dx()*scale), uint(bounds.Dy()*scale), img, resize.Bilinear)
+	tmp, err := os.CreateTemp(config.TMP_DIR, "faces-*.jpg")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+	if err = utils.EncodeJPEG(tmp, img); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
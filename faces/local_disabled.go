@@ -0,0 +1,10 @@
+//go:build !cgo || nogoface
+
+package faces
+
+import "errors"
+
+// Built with the "nogoface" tag or without CGO (no dlib), only the http backend is available
+func newLocal() (Detector, error) {
+	return nil, errors.New("built without go-face support, use the http backend")
+}
@@ -1,6 +1,11 @@
 package faces
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+)
 
 const (
 	IndexTop    = 0
@@ -12,7 +17,7 @@ const (
 type (
 	FaceBoundaries      [4]int
 	FaceBoundariesList  []FaceBoundaries
-	FaceEncoding        [128]float64
+	FaceEncoding        []float64
 	FaceEncodingList    []FaceEncoding
 	FaceDetectionResult struct {
 		Locations FaceBoundariesList `json:"locations"`
@@ -26,6 +31,27 @@ func toFacesResult(data []byte) (result FaceDetectionResult, err error) {
 	return result, err
 }
 
+func (r *FaceDetectionResult) toFaces() ([]Face, error) {
+	if len(r.Locations) != len(r.Encodings) {
+		return nil, errors.New("number of face locations and encodings differ")
+	}
+	result := make([]Face, 0, len(r.Locations))
+	for i, l := range r.Locations {
+		if len(r.Encodings[i]) != DescriptorSize {
+			return nil, fmt.Errorf("face encoding %d has %d values instead of %d", i, len(r.Encodings[i]), DescriptorSize)
+		}
+		descriptor := make([]float32, len(r.Encodings[i]))
+		for j, v := range r.Encodings[i] {
+			descriptor[j] = float32(v)
+		}
+		result = append(result, Face{
+			Rectangle:  image.Rect(l[IndexLeft], l[IndexTop], l[IndexRight], l[IndexBottom]),
+			Descriptor: descriptor,
+		})
+	}
+	return result, nil
+}
+
 func (l *FaceBoundaries) ToJSONString() string {
 	data, _ := json.Marshal(l)
 	return string(data)
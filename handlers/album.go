@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"fmt"
+	"log"
 	"net/http"
 	"server/db"
 	"server/models"
@@ -125,23 +126,95 @@ func AlbumList(c *gin.Context, user *models.User) {
 		albumInfo.Subtitle = utils.GetDatesString(minDate, maxDate)
 		result = append(result, albumInfo)
 	}
+	// If we don't have default hero image, pick the best one in the album
+	albumIDs := []uint64{}
+	for _, a := range result {
+		// TODO: We should save hero id when we add new asset to the album
+		if a.HeroAssetId == 0 {
+			albumIDs = append(albumIDs, a.ID)
+		}
+	}
+	heroes, err := albumHeroes(albumIDs)
+	if err != nil {
+		log.Printf("Error loading hero assets of albums for user %d: %v", user.ID, err)
+	}
 	for i, a := range result {
-		if a.HeroAssetId > 0 {
-			// TODO: We should save hero id when we add new asset to the album
-			continue
+		if a.HeroAssetId == 0 {
+			result[i].HeroAssetId = heroes[a.ID]
 		}
-		// If we don't have default hero image, pick the first one in the album
-		rows, err := db.Instance.Table("album_assets").Select("asset_id").Where("album_id = ?", a.ID).Order("created_at DESC").Limit(1).Rows()
-		if err != nil {
-			fmt.Println(err)
-			continue
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// albumHeroes returns the best scored asset of each album, or the last added one if none is scored yet (two queries for all albums)
+func albumHeroes(albumIDs []uint64) (map[uint64]uint64, error) {
+	heroes := map[uint64]uint64{}
+	if len(albumIDs) == 0 {
+		return heroes, nil
+	}
+	// Assets with the best score, the lowest ID if there are more
+	rows, err := db.Instance.Raw(`
+	select album_assets.album_id,
+		min(assets.id)
+	from   album_assets
+	join   assets
+		on assets.id = album_assets.asset_id
+	join   asset_qualities
+		on asset_qualities.asset_id = assets.id
+	join   (select album_assets.album_id,
+				max(asset_qualities.score) score
+		from   album_assets
+		join   assets
+			on assets.id = album_assets.asset_id
+		join   asset_qualities
+			on asset_qualities.asset_id = assets.id
+		where  album_assets.album_id in (?)
+				and assets.deleted = 0
+		group  by album_assets.album_id) best
+		on best.album_id = album_assets.album_id
+			and best.score = asset_qualities.score
+	where  album_assets.album_id in (?)
+			and assets.deleted = 0
+	group  by album_assets.album_id
+	`, albumIDs, albumIDs).Rows()
+	if err != nil {
+		return heroes, err
+	}
+	defer rows.Close()
+	var albumID, assetID uint64
+	for rows.Next() {
+		if err = rows.Scan(&albumID, &assetID); err != nil {
+			return heroes, err
+		}
+		heroes[albumID] = assetID
+	}
+	// ...or the last added ones
+	rows, err = db.Instance.Raw(`
+	select album_assets.album_id,
+		max(album_assets.asset_id)
+	from   album_assets
+	join   (select album_id,
+				max(created_at) created_at
+		from   album_assets
+		where  album_id in (?)
+		group  by album_id) last
+		on last.album_id = album_assets.album_id
+			and last.created_at = album_assets.created_at
+	group  by album_assets.album_id
+	`, albumIDs).Rows()
+	if err != nil {
+		return heroes, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = rows.Scan(&albumID, &assetID); err != nil {
+			return heroes, err
 		}
-		if rows.Next() {
-			_ = rows.Scan(&result[i].HeroAssetId)
+		if heroes[albumID] == 0 {
+			heroes[albumID] = assetID
 		}
-		rows.Close()
 	}
-	c.JSON(http.StatusOK, result)
+	return heroes, rows.Err()
 }
 
 func AlbumCreate(c *gin.Context, user *models.User) {
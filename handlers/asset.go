@@ -5,10 +5,14 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"path/filepath"
+	"server/config"
 	"server/db"
 	"server/models"
+	"server/processing"
 	"server/storage"
 	"server/utils"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,6 +21,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
 )
 
 type AssetFetchRequest struct {
@@ -24,6 +29,12 @@ type AssetFetchRequest struct {
 	Thumb    uint   `form:"thumb"`
 	Download uint   `form:"download"`
 	Size     uint   `form:"size"`
+	Original uint   `form:"original"` // Serve the original even if the asset was edited
+}
+
+type AssetListRequest struct {
+	Best    bool   `form:"best"`    // Only return the best shots (based on quality score)
+	Exclude string `form:"exclude"` // Comma-separated asset classes to exclude, e.g. "screenshot,document"
 }
 
 type AssetInfo struct {
@@ -39,18 +50,70 @@ type AssetInfo struct {
 	Size      uint64   `json:"size"`
 	MimeType  string   `json:"mime_type"`
 	Favourite bool     `json:"favourite"`
+	BlurHash  string   `json:"blurhash"`
+	Color     string   `json:"color"`  // Dominant colour, e.g. #a0b1c2
+	Edited    int64    `json:"edited"` // Time of the last edit (0 if not edited), can be used to refresh cached images
 }
 
 const (
 	// created_at field is adjusted with time_offset so the time can be shown "as UTC"
-	AssetsSelectClause   = "assets.id, assets.name, assets.user_id, assets.created_at+ifnull(time_offset,0), assets.remote_id, assets.mime_type, assets.gps_lat, assets.gps_long, locations.display, assets.size, assets.mime_type, favourite_assets.asset_id is not null as f"
+	AssetsSelectClause   = "assets.id, assets.name, assets.user_id, assets.created_at+ifnull(time_offset,0), assets.remote_id, assets.mime_type, assets.gps_lat, assets.gps_long, locations.display, assets.size, assets.mime_type, favourite_assets.asset_id is not null as f, ifnull(assets.blur_hash, ''), ifnull(assets.dominant_color, ''), ifnull((select asset_edits.updated_at from asset_edits where asset_edits.asset_id = assets.id), 0)"
 	LeftJoinForLocations = "left join locations ON locations.gps_lat = round(assets.gps_lat*10000-0.5)/10000.0 AND locations.gps_long = round(assets.gps_long*10000-0.5)/10000.0"
+	ExcludeClassesClause = "not exists (select 1 from asset_tags where asset_tags.asset_id = assets.id and asset_tags.source = ? and asset_tags.name in (?))"
+	// Own assets or ones in own albums or albums we contribute to (user ID is needed 3 times)
+	AccessibleAssetsClause = "(assets.user_id = ? OR exists (select 1 from album_assets join albums on albums.id = album_assets.album_id " +
+		"left join album_contributors on (album_contributors.album_id = albums.id and album_contributors.user_id = ?) " +
+		"where album_assets.asset_id = assets.id and (albums.user_id = ? OR album_contributors.user_id is not null)))"
+
+	// RAW files paired with a JPEG are only listed through the JPEG
+	NotPairedClause = "assets.paired_with_id is null"
+
+	searchTextMaxResults = 500
+	assetIDsBatchSize    = 500
 )
 
+type AssetDetailRequest struct {
+	ID uint64 `form:"id" binding:"required"`
+}
+
+type AssetDetail struct {
+	ID           uint64            `json:"id"`
+	Name         string            `json:"name"`
+	MimeType     string            `json:"mime_type"`
+	Created      int64             `json:"created"`
+	Size         int64             `json:"size"`
+	Width        uint16            `json:"width"`
+	Height       uint16            `json:"height"`
+	Duration     uint32            `json:"duration"`
+	GpsLat       *float64          `json:"gps_lat"`
+	GpsLong      *float64          `json:"gps_long"`
+	Camera       string            `json:"camera"`
+	Lens         string            `json:"lens"`
+	FocalLength  float64           `json:"focal_length"`  // in mm
+	ISO          int               `json:"iso"`           // e.g. 400
+	Aperture     float64           `json:"aperture"`      // f-number, e.g. 1.8
+	ShutterSpeed float64           `json:"shutter_speed"` // in seconds
+	Tags         []string          `json:"tags"`          // Asset classes and tags from processing hooks
+	Metadata     map[string]string `json:"metadata"`      // From processing hooks
+	PairedID     uint64            `json:"paired_id"`     // The RAW file for a JPEG (or vice versa) of the same shot, 0 if none
+	Caption      string            `json:"caption"`
+	TimeSource   string            `json:"time_source"` // Empty if from the file, "user" if corrected
+	GpsSource    string            `json:"gps_source"`  // Empty if from the file, "user" or "track" if set on the server
+}
+
+type AssetSearchTextRequest struct {
+	Query string `form:"q" binding:"required"`
+}
+
 type AssetDeleteRequest struct {
 	IDs []uint64 `json:"ids" binding:"required"`
 }
 
+type AssetCaptionRequest struct {
+	ID      uint64 `json:"id" binding:"required"`
+	Caption string `json:"caption" binding:"max=2000"`
+}
+
 type AssetFavouriteRequest struct {
 	ID           uint64 `json:"id" binding:"required"`
 	AlbumAssetID uint64 `json:"album_asset_id"`
@@ -73,7 +136,8 @@ func LoadAssetsFromRows(c *gin.Context, rows *sql.Rows) *[]AssetInfo {
 	for rows.Next() {
 		assetInfo := AssetInfo{}
 		if err := rows.Scan(&assetInfo.ID, &assetInfo.Name, &assetInfo.Owner, &assetInfo.Created, &assetInfo.DID, &mimeType,
-			&assetInfo.GpsLat, &assetInfo.GpsLong, &assetInfo.Location, &assetInfo.Size, &assetInfo.MimeType, &assetInfo.Favourite); err != nil {
+			&assetInfo.GpsLat, &assetInfo.GpsLong, &assetInfo.Location, &assetInfo.Size, &assetInfo.MimeType, &assetInfo.Favourite,
+			&assetInfo.BlurHash, &assetInfo.Color, &assetInfo.Edited); err != nil {
 
 			log.Printf("DB error: %v", err)
 			c.JSON(http.StatusInternalServerError, DBError2Response)
@@ -85,16 +149,43 @@ func LoadAssetsFromRows(c *gin.Context, rows *sql.Rows) *[]AssetInfo {
 	return &result
 }
 
+// excludedClasses parses the comma-separated "exclude" parameter
+func excludedClasses(exclude string) (result []string) {
+	for _, class := range strings.Split(exclude, ",") {
+		if class = strings.TrimSpace(class); class != "" {
+			result = append(result, class)
+		}
+	}
+	return
+}
+
+// BestAssetID returns the asset with the highest quality score out of the ones selected by tx,
+// or fallback if none of them has been scored yet
+func BestAssetID(tx *gorm.DB, fallback uint64) uint64 {
+	var id uint64
+	row := tx.Select("assets.id").
+		Joins("join asset_qualities on asset_qualities.asset_id = assets.id").
+		Order("asset_qualities.score DESC").
+		Limit(1).
+		Row()
+	if row.Scan(&id) != nil || id == 0 {
+		return fallback
+	}
+	return id
+}
+
 func AssetList(c *gin.Context, user *models.User) {
 	fr := AssetsForFaceRequest{}
 	_ = c.ShouldBindQuery(&fr)
+	r := AssetListRequest{}
+	_ = c.ShouldBindQuery(&r)
 
 	// Modified depends on deleted assets as well, that's why the where condition is different
 	tx := db.Instance.
 		Table("assets").
 		Select("max(updated_at)").
 		Where("user_id=? AND size>0 AND thumb_size>0", user.ID)
-	if fr.FaceID == 0 && c.Query("reload") != "1" && isNotModified(c, tx) {
+	if fr.FaceID == 0 && !r.Best && r.Exclude == "" && c.Query("reload") != "1" && isNotModified(c, tx) {
 		return
 	}
 	// TODO: For big sets maybe dynamically load asset info individually?
@@ -103,12 +194,21 @@ func AssetList(c *gin.Context, user *models.User) {
 		Select(AssetsSelectClause).
 		Joins("left join favourite_assets on favourite_assets.asset_id = assets.id").
 		Joins(LeftJoinForLocations)
+	if r.Best {
+		tmp = tmp.Joins("join asset_qualities on asset_qualities.asset_id = assets.id and asset_qualities.score >= ?", config.BEST_OF_MIN_SCORE)
+	}
+	if classes := excludedClasses(r.Exclude); len(classes) > 0 {
+		tmp = tmp.Where(ExcludeClassesClause, models.AssetTagSourceClassify, classes)
+	}
+	if config.RAW_JPEG_PAIRING {
+		tmp = tmp.Where(NotPairedClause)
+	}
+	tmp = tmp.Where("assets.user_id=? and assets.deleted=0 and assets.size>0 and assets.thumb_size>0", user.ID)
 	if fr.FaceID > 0 {
-		// Find assets with faces similar to the given face or with the same person already assigned
-		tmp = tmp.Joins("join (select distinct t2.asset_id from faces t1 join faces t2 where t1.id=? and (t1.person_id = t2.person_id OR "+models.FacesVectorDistance+" <= ?)) f on f.asset_id = assets.id", fr.FaceID, fr.Threshold)
+		assetsForFaceList(c, user, &fr, tmp)
+		return
 	}
-	rows, err := tmp.
-		Where("assets.user_id=? and assets.deleted=0 and assets.size>0 and assets.thumb_size>0", user.ID).Order("assets.created_at DESC").Rows()
+	rows, err := tmp.Order("assets.created_at DESC").Rows()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, DBError1Response)
 		return
@@ -121,6 +221,172 @@ func AssetList(c *gin.Context, user *models.User) {
 	c.JSON(http.StatusOK, result)
 }
 
+// assetsForFaceList responds with the assets of tx that have faces similar to the given face or with the same person already assigned
+func assetsForFaceList(c *gin.Context, user *models.User, fr *AssetsForFaceRequest, tx *gorm.DB) {
+	allowed, err := assetsForFace(user.ID, fr.FaceID, fr.Threshold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, DBError3Response)
+		return
+	}
+	ids := make([]uint64, 0, len(allowed))
+	for id := range allowed {
+		ids = append(ids, id)
+	}
+	// In batches, as SQLite limits the number of variables
+	tx = tx.Session(&gorm.Session{})
+	result := []AssetInfo{}
+	for start := 0; start < len(ids); start += assetIDsBatchSize {
+		rows, err := tx.Where("assets.id in (?)", ids[start:min(start+assetIDsBatchSize, len(ids))]).Rows()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, DBError1Response)
+			return
+		}
+		batch := LoadAssetsFromRows(c, rows)
+		rows.Close()
+		if batch == nil {
+			return
+		}
+		result = append(result, *batch...)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Created > result[j].Created
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+// assetsForFace returns the IDs of assets with faces within threshold (squared) of the given face or with the same person
+func assetsForFace(userID, faceID uint64, threshold float64) (map[uint64]bool, error) {
+	result := map[uint64]bool{}
+	descriptor := models.FaceIndex.Get(userID, faceID)
+	if descriptor == nil {
+		// Not one of the user's faces
+		return result, nil
+	}
+	for _, match := range models.FaceIndex.Search(userID, descriptor, threshold) {
+		result[match.AssetID] = true
+	}
+	face := models.Face{}
+	if err := db.Instance.Select("id", "person_id").Where("id = ?", faceID).Find(&face).Error; err != nil {
+		return nil, err
+	}
+	if face.PersonID != nil {
+		assetIDs := []uint64{}
+		err := db.Instance.Model(&models.Face{}).Where("user_id = ? and person_id = ?", userID, *face.PersonID).Distinct().Pluck("asset_id", &assetIDs).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range assetIDs {
+			result[id] = true
+		}
+	}
+	return result, nil
+}
+
+// AssetSearchText returns assets containing all the given words in their recognized (OCR) text
+func AssetSearchText(c *gin.Context, user *models.User) {
+	r := AssetSearchTextRequest{}
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	words := strings.Fields(r.Query)
+	if len(words) == 0 {
+		c.JSON(http.StatusBadRequest, Response{"Empty query"})
+		return
+	}
+	tx := db.Instance.
+		Table("asset_texts").
+		Select(AssetsSelectClause).
+		Joins("join assets on asset_texts.asset_id = assets.id").
+		Joins("left join favourite_assets on favourite_assets.asset_id = assets.id").
+		Joins(LeftJoinForLocations).
+		Where("assets.deleted=0 and "+AccessibleAssetsClause, user.ID, user.ID, user.ID)
+	for _, word := range words {
+		tx = tx.Where("asset_texts.text like ? "+db.LikeEscape, "%"+db.EscapeLike(word)+"%")
+	}
+	rows, err := tx.Order("assets.created_at DESC").Limit(searchTextMaxResults).Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	defer rows.Close()
+	result := LoadAssetsFromRows(c, rows)
+	if result == nil {
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func AssetGetDetail(c *gin.Context, user *models.User) {
+	r := AssetDetailRequest{}
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	asset := models.Asset{ID: r.ID}
+	if db.Instance.First(&asset).Error != nil || asset.Deleted {
+		c.JSON(http.StatusNotFound, NopeResponse)
+		return
+	}
+	if asset.UserID != user.ID && !checkAlbumAccess(c, user.ID, r.ID) {
+		return
+	}
+	exif := models.AssetExif{}
+	if err := db.Instance.Where("asset_id = ?", asset.ID).Find(&exif).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	tags := []string{}
+	if err := db.Instance.Model(&models.AssetTag{}).Where("asset_id = ?", asset.ID).Distinct().Order("name").Pluck("name", &tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError2Response)
+		return
+	}
+	metadata := []models.AssetMetadata{}
+	if err := db.Instance.Where("asset_id = ?", asset.ID).Order("id").Find(&metadata).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError3Response)
+		return
+	}
+	metadataMap := map[string]string{}
+	for _, m := range metadata {
+		metadataMap[m.Name] = m.Value
+	}
+	pairedID := uint64(0)
+	if asset.PairedWithID != nil {
+		pairedID = *asset.PairedWithID
+	} else if err := db.Instance.Model(&models.Asset{}).Select("id").Where("paired_with_id = ? and deleted=0", asset.ID).Limit(1).Scan(&pairedID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError4Response)
+		return
+	}
+	created := asset.CreatedAt
+	if asset.TimeOffset != nil {
+		created += int64(*asset.TimeOffset)
+	}
+	c.JSON(http.StatusOK, AssetDetail{
+		ID:           asset.ID,
+		Name:         asset.Name,
+		MimeType:     asset.MimeType,
+		Created:      created,
+		Size:         asset.Size,
+		Width:        asset.Width,
+		Height:       asset.Height,
+		Duration:     asset.Duration,
+		GpsLat:       asset.GpsLat,
+		GpsLong:      asset.GpsLong,
+		Camera:       exif.GetCamera(),
+		Lens:         exif.LensModel,
+		FocalLength:  exif.FocalLength,
+		ISO:          exif.ISO,
+		Aperture:     exif.FNumber,
+		ShutterSpeed: exif.ExposureTime,
+		Tags:         tags,
+		Metadata:     metadataMap,
+		PairedID:     pairedID,
+		Caption:      asset.Caption,
+		TimeSource:   asset.TimeSource,
+		GpsSource:    asset.GpsSource,
+	})
+}
+
 func AssetFetch(c *gin.Context, user *models.User) {
 	RealAssetFetch(c, user.ID)
 }
@@ -164,18 +430,45 @@ func RealAssetFetch(c *gin.Context, checkUser uint64) {
 	if storage == nil {
 		panic("Storage is nil")
 	}
+	// Serve the edited variants, unless the original is requested
+	edit := models.AssetEdit{}
+	if r.Original == 0 && asset.IsImage() {
+		db.Instance.Where("asset_id = ?", asset.ID).Find(&edit)
+	}
+	edited := edit.IsRendered()
+	c.Header("x-edited", strconv.FormatBool(edited))
+	// Browsers can't show RAW files, serve the extracted preview unless downloading
+	preview := !edited && asset.IsRaw() && asset.PreviewPath != "" && r.Download == 0
 	if asset.Bucket.IsS3() {
 		isThumb := false
 		if r.Thumb == 1 && asset.ThumbSize > 0 {
 			isThumb = true
 		}
 		// Redirect to the S3 location
-		url, expires := asset.GetS3DownloadURL(isThumb)
+		var url string
+		var expires int64
+		if edited {
+			url, expires = edit.GetS3DownloadURL(&asset.Bucket, isThumb)
+		} else if preview && !isThumb {
+			url, expires = asset.GetS3PreviewURL()
+		} else {
+			url, expires = asset.GetS3DownloadURL(isThumb)
+		}
 		maxAge := expires - time.Now().Unix()
 		c.Header("cache-control", "private, max-age="+strconv.FormatInt(maxAge, 10))
 		c.Redirect(302, url)
 		return
 	}
+	if edited {
+		// Not saved, only used to serve the edited files below
+		asset.ThumbPath = edit.ThumbPath
+		asset.Path = edit.DisplayPath
+		asset.MimeType = "image/jpeg"
+		asset.Name = strings.TrimSuffix(asset.Name, filepath.Ext(asset.Name)) + "_edited.jpg"
+	} else if preview {
+		asset.Path = asset.PreviewPath
+		asset.MimeType = "image/jpeg"
+	}
 	c.Header("cache-control", "private, max-age=604800")
 	if r.Thumb == 1 && asset.ThumbSize > 0 {
 		c.Header("content-type", "image/jpeg")
@@ -225,12 +518,19 @@ func AssetDelete(c *gin.Context, user *models.User) {
 			log.Printf("Asset: %d, auth error", id)
 			continue
 		}
+		edit := models.AssetEdit{}
+		db.Instance.Where("asset_id = ?", id).Find(&edit)
+		cropPaths := []string{}
+		db.Instance.Model(&models.Face{}).Where("asset_id = ? and crop_path != ''", id).Pluck("crop_path", &cropPaths)
 		// Delete asset record and rely on cascaded deletes
 		if db.Instance.Exec("delete from assets where id=?", id).Error != nil {
 			failed = append(failed, id)
 			log.Printf("Asset: %d, delete error %s", id, err)
 			continue
 		}
+		models.FaceIndex.RemoveAsset(asset.UserID, id)
+		// A RAW file paired with this asset is listed on its own again
+		db.Instance.Exec("update assets set paired_with_id=null where paired_with_id=?", id)
 		// Re-insert with same RemoteID to stop backing up the same asset
 		db.Instance.Exec("insert into assets (user_id, remote_id, updated_at, deleted) values (?, ?, ?, 1)", asset.UserID, asset.RemoteID, time.Now().Unix())
 
@@ -254,6 +554,33 @@ func AssetDelete(c *gin.Context, user *models.User) {
 		if err = storage.DeleteRemoteFile(asset.Path); err != nil {
 			log.Printf("Remote Asset: %d, delete error: %s", id, err.Error())
 		}
+		for _, path := range []string{edit.ThumbPath, edit.DisplayPath} {
+			if path != "" {
+				// Edited variants
+				_ = storage.Delete(path)
+				_ = storage.DeleteRemoteFile(path)
+			}
+		}
+		for _, path := range cropPaths {
+			// Face crops
+			_ = storage.Delete(path)
+			_ = storage.DeleteRemoteFile(path)
+		}
+		// XMP sidecar from metadata write-back (if any)
+		_ = storage.Delete(asset.SidecarPath())
+		_ = storage.DeleteRemoteFile(asset.SidecarPath())
+		if asset.PreviewPath != "" {
+			// Extracted RAW preview
+			_ = storage.Delete(asset.PreviewPath)
+			_ = storage.DeleteRemoteFile(asset.PreviewPath)
+		}
+		if asset.OriginalPath != "" {
+			// Original video kept by the transcoding profile
+			_ = storage.Delete(asset.OriginalPath)
+			if err = storage.DeleteRemoteFile(asset.OriginalPath); err != nil {
+				log.Printf("Remote Asset: %d, original delete error: %s", id, err.Error())
+			}
+		}
 	}
 	// Handle errors
 	if len(failed) > 0 {
@@ -308,6 +635,9 @@ func AssetFavourite(c *gin.Context, user *models.User) {
 		c.JSON(http.StatusInternalServerError, DBError1Response)
 		return
 	}
+	if r.AlbumAssetID == 0 {
+		requestWriteback(r.ID)
+	}
 	c.JSON(http.StatusOK, OKResponse)
 }
 
@@ -328,5 +658,35 @@ func AssetUnfavourite(c *gin.Context, user *models.User) {
 		c.JSON(http.StatusInternalServerError, DBError3Response)
 		return
 	}
+	if fav.AlbumAssetID == nil {
+		requestWriteback(r.ID)
+	}
+	c.JSON(http.StatusOK, OKResponse)
+}
+
+// AssetCaption sets the caption of an own asset
+func AssetCaption(c *gin.Context, user *models.User) {
+	r := AssetCaptionRequest{}
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	asset := models.Asset{ID: r.ID}
+	if db.Instance.First(&asset).Error != nil || asset.Deleted || asset.UserID != user.ID {
+		c.JSON(http.StatusNotFound, NopeResponse)
+		return
+	}
+	if err := db.Instance.Model(&asset).Update("caption", strings.TrimSpace(r.Caption)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	requestWriteback(asset.ID)
 	c.JSON(http.StatusOK, OKResponse)
 }
+
+// requestWriteback schedules writing the metadata back to the files, errors are only logged as the change itself is saved
+func requestWriteback(assetIDs ...uint64) {
+	if err := processing.RequestWriteback(assetIDs); err != nil {
+		log.Printf("Error requesting metadata write-back for assets %v: %v", assetIDs, err)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"server/db"
+	"server/models"
+	"server/processing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type AssetEditRequest struct {
+	ID uint64 `form:"id" json:"id" binding:"required"`
+}
+
+// loadEditableAsset returns the asset if it's an image owned by the user (or nil after responding with an error)
+func loadEditableAsset(c *gin.Context, user *models.User, id uint64) *models.Asset {
+	asset := models.Asset{ID: id}
+	if db.Instance.Joins("Bucket").First(&asset).Error != nil || asset.Deleted || asset.UserID != user.ID {
+		c.JSON(http.StatusNotFound, NopeResponse)
+		return nil
+	}
+	if !asset.IsImage() || asset.ThumbSize == 0 {
+		c.JSON(http.StatusBadRequest, Response{"Only images can be edited"})
+		return nil
+	}
+	return &asset
+}
+
+// AssetEditGet returns the current edit of an asset (all zeros if not edited)
+func AssetEditGet(c *gin.Context, user *models.User) {
+	r := AssetEditRequest{}
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	asset := loadEditableAsset(c, user, r.ID)
+	if asset == nil {
+		return
+	}
+	edit := models.AssetEdit{}
+	if err := db.Instance.Where("asset_id = ?", asset.ID).Find(&edit).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	edit.AssetID = asset.ID
+	c.JSON(http.StatusOK, edit)
+}
+
+// AssetEditSave saves the edit and renders the edited variants, the original is kept untouched
+func AssetEditSave(c *gin.Context, user *models.User) {
+	edit := models.AssetEdit{}
+	if err := c.ShouldBindWith(&edit, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	if err := edit.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	asset := loadEditableAsset(c, user, edit.AssetID)
+	if asset == nil {
+		return
+	}
+	if err := processing.RenderEdit(asset, &edit); err != nil {
+		log.Printf("Error rendering edit for asset ID %d: %v", asset.ID, err)
+		c.JSON(http.StatusInternalServerError, Response{"Cannot render the edited image"})
+		return
+	}
+	// Clients reload the asset list (and its edited flag) based on the last update time
+	if err := db.Instance.Model(asset).Update("updated_at", time.Now().Unix()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	c.JSON(http.StatusOK, edit)
+}
+
+// AssetEditReset removes all edits, so the original is shown again
+func AssetEditReset(c *gin.Context, user *models.User) {
+	r := AssetEditRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	asset := loadEditableAsset(c, user, r.ID)
+	if asset == nil {
+		return
+	}
+	edit := models.AssetEdit{}
+	if err := db.Instance.Where("asset_id = ?", asset.ID).Find(&edit).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	if edit.AssetID == 0 {
+		c.JSON(http.StatusOK, OKResponse)
+		return
+	}
+	if err := processing.DeleteEdit(asset, &edit); err != nil {
+		log.Printf("Error deleting edit for asset ID %d: %v", asset.ID, err)
+		c.JSON(http.StatusInternalServerError, DBError2Response)
+		return
+	}
+	if err := db.Instance.Model(asset).Update("updated_at", time.Now().Unix()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError3Response)
+		return
+	}
+	c.JSON(http.StatusOK, OKResponse)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"server/db"
+	"server/models"
+	"server/processing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+type AssetLocationRequest struct {
+	IDs      []uint64 `json:"ids" binding:"required"`
+	GpsLat   *float64 `json:"gps_lat"` // Set the coordinates, or...
+	GpsLong  *float64 `json:"gps_long"`
+	PlaceID  uint64   `json:"place_id"`  // ...use an existing place, or...
+	SourceID uint64   `json:"source_id"` // ...copy the location of another asset, or...
+	Clear    bool     `json:"clear"`     // ...remove the location
+}
+
+// AssetSetLocation sets (or clears) the location of own assets, places are then resolved by the location task
+func AssetSetLocation(c *gin.Context, user *models.User) {
+	r := AssetLocationRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	options := 0
+	for _, set := range []bool{r.GpsLat != nil || r.GpsLong != nil, r.PlaceID != 0, r.SourceID != 0, r.Clear} {
+		if set {
+			options++
+		}
+	}
+	if options != 1 {
+		c.JSON(http.StatusBadRequest, Response{"Exactly one of coordinates, place_id, source_id or clear is needed"})
+		return
+	}
+	var placeID *uint64
+	switch {
+	case r.GpsLat != nil || r.GpsLong != nil:
+		if r.GpsLat == nil || r.GpsLong == nil || *r.GpsLat < -90 || *r.GpsLat > 90 || *r.GpsLong < -180 || *r.GpsLong > 180 {
+			c.JSON(http.StatusBadRequest, Response{"Invalid coordinates"})
+			return
+		}
+	case r.SourceID != 0:
+		source := models.Asset{}
+		err := db.Instance.Table("assets").
+			Where("assets.id = ? and assets.deleted=0 and "+AccessibleAssetsClause, r.SourceID, user.ID, user.ID, user.ID).
+			Find(&source).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, DBError1Response)
+			return
+		}
+		if source.ID == 0 || source.GpsLat == nil || source.GpsLong == nil {
+			c.JSON(http.StatusBadRequest, Response{"The source asset has no location"})
+			return
+		}
+		r.GpsLat, r.GpsLong, placeID = source.GpsLat, source.GpsLong, source.PlaceID
+	case r.PlaceID != 0:
+		if !placeCoordinates(c, user, &r) {
+			return
+		}
+		placeID = &r.PlaceID
+	}
+	assets := []models.Asset{}
+	if err := db.Instance.Where("id in (?) and user_id = ? and deleted=0", r.IDs, user.ID).Find(&assets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError2Response)
+		return
+	}
+	if len(assets) != len(r.IDs) {
+		c.JSON(http.StatusUnauthorized, NopeResponse)
+		return
+	}
+	ids := []uint64{}
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		for _, asset := range assets {
+			// Updating updated_at makes the clients reload the assets
+			err := tx.Model(&asset).Updates(map[string]any{
+				"gps_lat":    r.GpsLat,
+				"gps_long":   r.GpsLong,
+				"place_id":   placeID,
+				"gps_source": models.MetadataSourceUser,
+				"updated_at": time.Now().Unix(),
+			}).Error
+			if err != nil {
+				return err
+			}
+			ids = append(ids, asset.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error setting location of assets %v: %v", r.IDs, err)
+		c.JSON(http.StatusInternalServerError, DBError3Response)
+		return
+	}
+	if placeID == nil && !r.Clear {
+		if err = processing.ResetTasks(ids, "location"); err != nil {
+			log.Printf("Error resetting location task: %v", err)
+			c.JSON(http.StatusInternalServerError, DBError4Response)
+			return
+		}
+	}
+	requestWriteback(ids...)
+	c.JSON(http.StatusOK, OKResponse)
+}
+
+// placeCoordinates finds coordinates for a place, from the user's own assets or the known locations (false after responding with an error)
+func placeCoordinates(c *gin.Context, user *models.User, r *AssetLocationRequest) bool {
+	place := models.Place{ID: r.PlaceID}
+	if db.Instance.First(&place).Error != nil {
+		c.JSON(http.StatusNotFound, NopeResponse)
+		return false
+	}
+	asset := models.Asset{}
+	err := db.Instance.Where("user_id = ? and place_id = ? and deleted=0 and gps_lat is not null and gps_long is not null", user.ID, place.ID).
+		Order("created_at desc").Limit(1).Find(&asset).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return false
+	}
+	if asset.ID != 0 {
+		r.GpsLat, r.GpsLong = asset.GpsLat, asset.GpsLong
+		return true
+	}
+	location := models.Location{}
+	err = db.Instance.Where("area = ? and city = ? and country = ?", place.Area, place.City, place.Country).Limit(1).Find(&location).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return false
+	}
+	if location.Display == "" {
+		c.JSON(http.StatusBadRequest, Response{"No coordinates known for this place"})
+		return false
+	}
+	r.GpsLat, r.GpsLong = &location.GpsLat, &location.GpsLong
+	return true
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"server/db"
+	"server/models"
+	"server/processing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+const (
+	maxTimeOffset = 14 * 3600 // UTC+14 is the furthest time zone
+)
+
+type AssetShiftTimeRequest struct {
+	IDs           []uint64 `json:"ids" binding:"required"`
+	Shift         int64    `json:"shift"`          // Seconds to add to the time of all assets (can be negative)
+	ReferenceID   uint64   `json:"reference_id"`   // Or, one of the assets and...
+	ReferenceTime int64    `json:"reference_time"` // ...the (local) time it was actually taken at, the others are shifted by the same amount
+	TimeOffset    *int     `json:"time_offset"`    // New time zone (UTC offset in seconds), the local time stays the same
+}
+
+type AssetTimeInfo struct {
+	ID         uint64 `json:"id"`
+	Created    int64  `json:"created"` // Local time, as in AssetInfo
+	TimeOffset *int   `json:"time_offset"`
+}
+
+// AssetShiftTime corrects the time and/or time zone of own assets, e.g. when the camera's clock was wrong
+func AssetShiftTime(c *gin.Context, user *models.User) {
+	r := AssetShiftTimeRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	if r.Shift != 0 && r.ReferenceID != 0 {
+		c.JSON(http.StatusBadRequest, Response{"Either shift or reference can be used"})
+		return
+	}
+	if r.Shift == 0 && r.ReferenceID == 0 && r.TimeOffset == nil {
+		c.JSON(http.StatusBadRequest, Response{"Nothing to change"})
+		return
+	}
+	if r.TimeOffset != nil && (*r.TimeOffset < -maxTimeOffset || *r.TimeOffset > maxTimeOffset) {
+		c.JSON(http.StatusBadRequest, Response{"Invalid time offset"})
+		return
+	}
+	assets := []models.Asset{}
+	if err := db.Instance.Where("id in (?) and user_id = ? and deleted=0", r.IDs, user.ID).Find(&assets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	if len(assets) != len(r.IDs) {
+		c.JSON(http.StatusUnauthorized, NopeResponse)
+		return
+	}
+	shift := r.Shift
+	if r.ReferenceID != 0 {
+		found := false
+		for _, asset := range assets {
+			if asset.ID == r.ReferenceID {
+				shift = r.ReferenceTime - localTime(&asset)
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.JSON(http.StatusBadRequest, Response{"The reference asset must be one of the assets"})
+			return
+		}
+	}
+	now := time.Now().Unix()
+	result := []AssetTimeInfo{}
+	ids := []uint64{}
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		for _, asset := range assets {
+			if r.TimeOffset != nil {
+				// Same local time in the new time zone
+				asset.CreatedAt = localTime(&asset) - int64(*r.TimeOffset)
+				asset.TimeOffset = r.TimeOffset
+			}
+			asset.CreatedAt += shift
+			// Updating updated_at makes the clients reload the assets
+			err := tx.Model(&asset).Updates(map[string]any{
+				"created_at":  asset.CreatedAt,
+				"time_offset": asset.TimeOffset,
+				"time_source": models.MetadataSourceUser,
+				"updated_at":  now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			result = append(result, AssetTimeInfo{ID: asset.ID, Created: localTime(&asset), TimeOffset: asset.TimeOffset})
+			ids = append(ids, asset.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error shifting time of assets %v: %v", r.IDs, err)
+		c.JSON(http.StatusInternalServerError, DBError2Response)
+		return
+	}
+	// RAW+JPEG pairing depends on the time
+	if err = processing.ResetTasks(ids, "rawpair"); err != nil {
+		log.Printf("Error resetting tasks after time shift: %v", err)
+	}
+	requestWriteback(ids...)
+	c.JSON(http.StatusOK, result)
+}
+
+// localTime returns the time as shown in the clients (local time as if it was UTC)
+func localTime(asset *models.Asset) int64 {
+	if asset.TimeOffset == nil {
+		return asset.CreatedAt
+	}
+	return asset.CreatedAt + int64(*asset.TimeOffset)
+}
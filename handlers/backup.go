@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"bytes"
-	"image"
 	"io"
 	"mime"
 	"net/http"
@@ -10,6 +9,7 @@ import (
 	"server/db"
 	"server/models"
 	"server/storage"
+	"server/utils"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -113,7 +113,10 @@ func NewMetadata(c *gin.Context, user *models.User, r *BackupRequest) *models.As
 		Duration:   r.Duration,
 		TimeOffset: r.TimeOffset,
 	}
-	if r.MimeType != "" {
+	if raw := models.RawMimeTypeByExtension(asset.Name); raw != "" {
+		// Clients report RAW files differently (or as application/octet-stream), use one mime type for each format
+		asset.MimeType = raw
+	} else if r.MimeType != "" {
 		asset.MimeType = r.MimeType
 	} else {
 		// Guess the mime type from the extension
@@ -125,6 +128,7 @@ func NewMetadata(c *gin.Context, user *models.User, r *BackupRequest) *models.As
 		asset.MimeType != "image/gif" &&
 		asset.MimeType != "image/heic" && // TODO: which one to remain?
 		asset.MimeType != "image/heif" &&
+		!asset.IsRaw() &&
 		!strings.HasPrefix(asset.MimeType, "video/") {
 
 		c.JSON(http.StatusForbidden, Response{"this file type is not allowed"})
@@ -201,13 +205,25 @@ func BackupLocalAsset(userID uint64, c *gin.Context) {
 	}
 	if r.Thumb {
 		asset.ThumbSize = size
-		thumb, _, err := image.Decode(&thumbContent)
+		// Store the thumbnail upright, so all consumers (incl. face detection) see the same pixels
+		thumb, orientation, err := utils.DecodeImage(&thumbContent)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, Response{err.Error()})
 			return
 		}
+		if orientation != utils.OrientationNormal {
+			upright := bytes.Buffer{}
+			if err = utils.EncodeJPEG(&upright, thumb); err == nil {
+				asset.ThumbSize, err = storage.Save(asset.ThumbPath, &upright)
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, Response{err.Error()})
+				return
+			}
+		}
 		asset.ThumbWidth = uint16(thumb.Bounds().Dx())
 		asset.ThumbHeight = uint16(thumb.Bounds().Dy())
+		asset.SetPlaceholders(thumb)
 	} else {
 		asset.Size = size
 	}
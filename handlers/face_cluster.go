@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"server/db"
+	"server/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+const (
+	faceClusterSampleSize = 6 // Faces returned for each cluster in the list
+)
+
+type FaceClusterInfo struct {
+	ID    uint64     `json:"id"`
+	Size  int        `json:"size"`
+	Faces []FaceInfo `json:"faces"` // A few of the faces, to show
+}
+
+type FaceClusterRequest struct {
+	ID   uint64 `json:"id" binding:"required"`
+	Name string `json:"name"` // Person name, when naming the cluster
+}
+
+// FaceClusterList returns the suggested groups of similar faces, largest first
+func FaceClusterList(c *gin.Context, user *models.User) {
+	// Faces leave clusters when assigned or detected again, so the current sizes are counted (empty clusters are skipped)
+	clusters := []models.FaceCluster{}
+	err := db.Instance.
+		Table("face_clusters").
+		Select("face_clusters.id, count(faces.id) as size").
+		Joins("join faces on faces.cluster_id = face_clusters.id and faces.person_id is null").
+		Where("face_clusters.user_id = ? and face_clusters.dismissed = ?", user.ID, false).
+		Group("face_clusters.id").
+		Order("size desc, face_clusters.id").
+		Scan(&clusters).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	result := []FaceClusterInfo{}
+	for _, cluster := range clusters {
+		info := FaceClusterInfo{ID: cluster.ID, Size: cluster.Size, Faces: []FaceInfo{}}
+		rows, err := db.Instance.Raw("select id, asset_id, num, x1, y1, x2, y2 from faces where cluster_id=? and person_id is null order by created_at desc limit ?", cluster.ID, faceClusterSampleSize).Rows()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, DBError2Response)
+			return
+		}
+		for rows.Next() {
+			face := FaceInfo{}
+			if err = rows.Scan(&face.ID, &face.AsselID, &face.Num, &face.X1, &face.Y1, &face.X2, &face.Y2); err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, DBError3Response)
+				return
+			}
+			info.Faces = append(info.Faces, face)
+		}
+		rows.Close()
+		result = append(result, info)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// loadFaceCluster returns the user's (not dismissed) cluster or nil after responding with an error
+func loadFaceCluster(c *gin.Context, user *models.User, r *FaceClusterRequest) *models.FaceCluster {
+	if err := c.ShouldBindWith(r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return nil
+	}
+	cluster := models.FaceCluster{ID: r.ID}
+	if db.Instance.First(&cluster).Error != nil || cluster.UserID != user.ID || cluster.Dismissed {
+		c.JSON(http.StatusNotFound, NopeResponse)
+		return nil
+	}
+	return &cluster
+}
+
+// FaceClusterName assigns all faces of the cluster to a person with the given name (created if needed)
+func FaceClusterName(c *gin.Context, user *models.User) {
+	r := FaceClusterRequest{}
+	cluster := loadFaceCluster(c, user, &r)
+	if cluster == nil {
+		return
+	}
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		c.JSON(http.StatusBadRequest, Response{"Empty person name"})
+		return
+	}
+	person := models.Person{UserID: user.ID, Name: r.Name}
+	assetIDs := []uint64{}
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(&person, "user_id", "name").FirstOrCreate(&person).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Face{}).Where("cluster_id = ?", cluster.ID).Distinct().Pluck("asset_id", &assetIDs).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&models.Face{}).Where("cluster_id = ? and person_id is null and "+models.NotRejectedFaceClause, cluster.ID, person.ID).
+			Updates(map[string]any{"person_id": person.ID, "cluster_id": nil}).Error
+		if err != nil {
+			return err
+		}
+		// Rejected faces are left unassigned, they can be clustered again
+		if err = tx.Model(&models.Face{}).Where("cluster_id = ?", cluster.ID).Update("cluster_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(cluster).Error
+	})
+	if err != nil {
+		log.Printf("Error naming face cluster ID %d: %v", cluster.ID, err)
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	requestWriteback(assetIDs...)
+	c.JSON(http.StatusOK, FaceInfo{PersonID: person.ID, PersonName: person.Name})
+}
+
+// FaceClusterDismiss hides the cluster, its faces are not suggested again
+func FaceClusterDismiss(c *gin.Context, user *models.User) {
+	r := FaceClusterRequest{}
+	cluster := loadFaceCluster(c, user, &r)
+	if cluster == nil {
+		return
+	}
+	if err := db.Instance.Model(cluster).Update("dismissed", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	c.JSON(http.StatusOK, OKResponse)
+}
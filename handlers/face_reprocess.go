@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"server/db"
+	"server/faces"
+	"server/models"
+	"server/processing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type FaceReprocessRequest struct {
+	IDs      []uint64 `json:"ids"`      // Selected assets, or...
+	AlbumID  uint64   `json:"album_id"` // ...own assets in an album, or...
+	All      bool     `json:"all"`      // ...all own assets
+	CNN      bool     `json:"cnn"`      // Use CNN instead of HOG detection
+	Upsample int      `json:"upsample"` // 0 to 2, finds smaller faces
+	MinSize  int      `json:"min_size"` // Ignore faces smaller than this (in thumbnail pixels)
+}
+
+type FaceReprocessResponse struct {
+	Assets int `json:"assets"` // Number of assets queued
+}
+
+// FaceReprocess runs face detection again for own assets with the given options.
+// Existing faces are replaced, people assigned to faces are kept if the new face boxes overlap the old ones
+func FaceReprocess(c *gin.Context, user *models.User) {
+	r := FaceReprocessRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	selections := 0
+	for _, set := range []bool{len(r.IDs) > 0, r.AlbumID != 0, r.All} {
+		if set {
+			selections++
+		}
+	}
+	if selections != 1 {
+		c.JSON(http.StatusBadRequest, Response{"Exactly one of ids, album_id or all is needed"})
+		return
+	}
+	if r.Upsample < 0 || r.Upsample > faces.MaxUpsample || r.MinSize < 0 {
+		c.JSON(http.StatusBadRequest, Response{"Invalid detection options"})
+		return
+	}
+	tx := db.Instance.Model(&models.Asset{}).Where("assets.user_id = ? and assets.deleted=0 and assets.thumb_size>0", user.ID)
+	switch {
+	case len(r.IDs) > 0:
+		tx = tx.Where("assets.id in (?)", r.IDs)
+	case r.AlbumID != 0:
+		tx = tx.Where("exists (select 1 from album_assets where album_assets.asset_id = assets.id and album_assets.album_id = ?)", r.AlbumID)
+	}
+	ids := []uint64{}
+	if err := tx.Pluck("assets.id", &ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	if len(r.IDs) > 0 && len(ids) != len(r.IDs) {
+		c.JSON(http.StatusUnauthorized, NopeResponse)
+		return
+	}
+	if err := processing.RequestFaceDetection(ids, faces.Options{CNN: r.CNN, Upsample: r.Upsample, MinSize: r.MinSize}); err != nil {
+		log.Printf("Error requesting face detection for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, DBError2Response)
+		return
+	}
+	c.JSON(http.StatusOK, FaceReprocessResponse{Assets: len(ids)})
+}
@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"server/config"
 	"server/db"
 	"server/models"
+	"server/processing"
+	"server/storage"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "image/jpeg"
 
@@ -23,6 +27,12 @@ type FaceInfo struct {
 	Y1         int    `json:"y1"`
 	X2         int    `json:"x2"`
 	Y2         int    `json:"y2"`
+	Hidden     bool   `json:"hidden,omitempty"` // Person is hidden (people list only)
+	Shared     bool   `json:"shared,omitempty"` // Person is shared by another user (people list only)
+}
+
+type FaceCropRequest struct {
+	ID uint64 `form:"id" binding:"required"` // Face ID
 }
 
 type AssetsForFaceRequest struct {
@@ -74,28 +84,35 @@ func FacesForAsset(c *gin.Context, user *models.User) {
 }
 
 func PeopleList(c *gin.Context, user *models.User) {
-	// Do this in two steps. First load all people information
-	rows, err := db.Instance.Raw("select id, name from people where user_id=?", user.ID).Rows()
+	// Do this in two steps. First load all people information, including shared people (hidden ones only with all=1)
+	rows, err := db.Instance.Raw("select id, name, hidden, ifnull(avatar_face_id, 0), user_id from people where "+models.AccessiblePeopleClause+" and (hidden=? or ?)",
+		user.ID, user.ID, user.ID, false, c.Query("all") == "1").Rows()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, DBError1Response)
 		return
 	}
 	// Put the info in the FaceInfo struct
 	people := []FaceInfo{}
+	avatars := map[uint64]uint64{}
 	for rows.Next() {
 		person := FaceInfo{}
-		if err = rows.Scan(&person.PersonID, &person.PersonName); err != nil {
+		avatarID, ownerID := uint64(0), uint64(0)
+		if err = rows.Scan(&person.PersonID, &person.PersonName, &person.Hidden, &avatarID, &ownerID); err != nil {
 			c.JSON(http.StatusInternalServerError, DBError2Response)
 			rows.Close()
 			return
 		}
+		person.Shared = ownerID != user.ID
 		people = append(people, person)
+		avatars[person.PersonID] = avatarID
 	}
 	rows.Close()
 
-	// Now load the last face for each person
+	// Now load the avatar (or the last face) for each person, only from assets the user can see
 	for i, person := range people {
-		rows, err = db.Instance.Raw("select id, asset_id, num, x1, y1, x2, y2 from faces where person_id=? order by created_at desc limit 1", person.PersonID).Rows()
+		rows, err = db.Instance.Raw("select faces.id, faces.asset_id, faces.num, faces.x1, faces.y1, faces.x2, faces.y2 from faces join assets on assets.id = faces.asset_id "+
+			"where faces.person_id=? and assets.deleted=0 and "+AccessibleAssetsClause+" order by faces.id=? desc, faces.created_at desc limit 1",
+			person.PersonID, user.ID, user.ID, user.ID, avatars[person.PersonID]).Rows()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, DBError3Response)
 			return
@@ -147,25 +164,37 @@ func PersonAssignFace(c *gin.Context, user *models.User) {
 			return
 		}
 		// We want to unassign a face from a person
-		if db.Instance.Exec("update faces set person_id=null where id=?", face.ID).Error != nil {
+		if db.Instance.Exec("update faces set person_id=null where id=? and user_id=?", face.ID, user.ID).Error != nil {
 			c.JSON(http.StatusInternalServerError, DBError1Response)
 			return
 		}
 		face.PersonID = 0
 		face.PersonName = ""
+		assetIDs := []uint64{}
+		db.Instance.Model(&models.Face{}).Where("id = ?", face.ID).Pluck("asset_id", &assetIDs)
+		requestWriteback(assetIDs...)
 		c.JSON(http.StatusOK, face)
 		return
 	}
-	// Check if this face.PersonID is the same as current user.ID
+	// Check if this face.PersonID is the user's own or shared with them
 	person := models.Person{ID: face.PersonID}
-	if db.Instance.First(&person).Error != nil || person.UserID != user.ID {
+	if db.Instance.First(&person).Error != nil || !models.CanAccessPerson(user.ID, person.ID) {
 		c.JSON(http.StatusUnauthorized, NopeResponse)
 		return
 	}
-	if db.Instance.Exec("update faces set person_id=? where id=?", face.PersonID, face.ID).Error != nil {
+	// Assigned faces are no longer part of the suggested clusters
+	res := db.Instance.Exec("update faces set person_id=?, cluster_id=null where id=? and user_id=? and (person_id is null or person_id != ?)", face.PersonID, face.ID, user.ID, face.PersonID)
+	if res.Error != nil {
 		c.JSON(http.StatusInternalServerError, DBError1Response)
 		return
 	}
+	// Only the assets with changed faces are written back
+	assetIDs := []uint64{}
+	if res.RowsAffected > 0 {
+		db.Instance.Model(&models.Face{}).Where("id = ?", face.ID).Pluck("asset_id", &assetIDs)
+	}
+	// Assigning by hand overrides an earlier "not this person"
+	db.Instance.Where("face_id = ? and person_id = ?", face.ID, face.PersonID).Delete(&models.FaceRejection{})
 	// threshold is squared by default
 	thresholdStr := c.Query("threshold")
 	threshold, _ := strconv.ParseFloat(thresholdStr, 64)
@@ -174,25 +203,71 @@ func PersonAssignFace(c *gin.Context, user *models.User) {
 	}
 	// Set PersonID to all assets with faces similar to the given face based on threshold
 	// Also, make sure the distance is greater than the current face's distance (i.e. the new face is more similar to the one detected before)
-	if db.Instance.Exec(`update faces 
-						set person_id=? 
-						where id in (
-							select id from (
-								select t2.id 
-								from faces t1 join faces t2 
-								where t1.id=? and 
-									t1.id!=t2.id and 
-									t1.user_id=? and 
-									t1.user_id=t2.user_id and 
-									`+models.FacesVectorDistance+` <= ? and 
-									(t2.distance = 0 OR t2.distance > `+models.FacesVectorDistance+`)
-							) tmp
-						)`,
-		face.PersonID, face.ID, user.ID, threshold).Error != nil {
-
-		c.JSON(http.StatusInternalServerError, DBError2Response)
-		return
+	for _, match := range models.FaceIndex.Search(user.ID, models.FaceIndex.Get(user.ID, face.ID), threshold) {
+		if match.FaceID == face.ID {
+			continue
+		}
+		res = db.Instance.Exec("update faces set person_id=?, cluster_id=null where id=? and user_id=? and (person_id is null or person_id != ?) and (distance = 0 OR distance > ?) and "+models.NotRejectedFaceClause,
+			face.PersonID, match.FaceID, user.ID, face.PersonID, match.DistanceSq, face.PersonID)
+		if res.Error != nil {
+			c.JSON(http.StatusInternalServerError, DBError2Response)
+			return
+		}
+		if res.RowsAffected > 0 {
+			assetIDs = append(assetIDs, match.AssetID)
+		}
 	}
+	requestWriteback(assetIDs...)
 	face.PersonName = person.Name
 	c.JSON(http.StatusOK, face)
 }
+
+// FaceCrop returns a square crop of the face, from own assets or ones in albums shared with the user
+func FaceCrop(c *gin.Context, user *models.User) {
+	RealFaceCrop(c, user.ID)
+}
+
+// RealFaceCrop serves the face crop (rendered on first request). Access must be verified by the caller if checkUser is 0
+func RealFaceCrop(c *gin.Context, checkUser uint64) {
+	r := FaceCropRequest{}
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	face := models.Face{}
+	if db.Instance.Where("id = ?", r.ID).Find(&face).Error != nil || face.ID == 0 {
+		c.JSON(http.StatusNotFound, NopeResponse)
+		return
+	}
+	asset := models.Asset{ID: face.AssetID}
+	if db.Instance.Joins("Bucket").First(&asset).Error != nil || asset.Deleted || asset.ThumbSize == 0 {
+		c.JSON(http.StatusNotFound, NopeResponse)
+		return
+	}
+	if checkUser > 0 && asset.UserID != checkUser {
+		if !checkAlbumAccess(c, checkUser, asset.ID) {
+			return
+		}
+	}
+	if err := processing.RenderFaceCrop(&face, &asset); err != nil {
+		log.Printf("Error rendering crop of face ID %d: %v", face.ID, err)
+		c.JSON(http.StatusInternalServerError, Response{"Cannot render the face crop"})
+		return
+	}
+	if asset.Bucket.IsS3() {
+		url, expires := face.GetS3CropURL(&asset)
+		c.Header("cache-control", "private, max-age="+strconv.FormatInt(expires-time.Now().Unix(), 10))
+		c.Redirect(302, url)
+		return
+	}
+	storage := storage.StorageFrom(&asset.Bucket)
+	if storage == nil {
+		c.JSON(http.StatusInternalServerError, Response{"Storage is nil"})
+		return
+	}
+	c.Header("cache-control", "private, max-age=604800")
+	c.Header("content-type", "image/jpeg")
+	if _, err := storage.Load(face.CropPath, c.Writer); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{err.Error()})
+	}
+}
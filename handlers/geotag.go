@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"server/db"
+	"server/locations"
+	"server/models"
+	"server/processing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	geotagDefaultMaxGap = 300   // Seconds between an asset and the closest track point(s)
+	geotagMaxGapLimit   = 86400 // Anything bigger is not really tracking
+)
+
+type GeotagRequest struct {
+	Track      string   `json:"track" binding:"required"` // GPX, KML or GeoJSON contents
+	MaxGap     int64    `json:"max_gap"`                  // In seconds, defaults to 5 minutes
+	TimeOffset int64    `json:"time_offset"`              // Camera's UTC offset in seconds, for assets without time zone info (e.g. 3600 for UTC+1)
+	IDs        []uint64 `json:"ids"`                      // Only apply to these assets (from the preview), optional
+}
+
+type GeotagMatch struct {
+	ID      uint64  `json:"id"`
+	Created int64   `json:"created"` // UTC time used for matching
+	GpsLat  float64 `json:"gps_lat"`
+	GpsLong float64 `json:"gps_long"`
+	setTime bool    // The time zone is now known, so the time can be saved as UTC
+}
+
+type GeotagResponse struct {
+	Start   int64         `json:"start"` // Track start and end times
+	End     int64         `json:"end"`
+	Matches []GeotagMatch `json:"matches"`
+}
+
+// geotagMatches finds own assets without location and their position on the track (or nil after responding with an error)
+func geotagMatches(c *gin.Context, user *models.User, r *GeotagRequest) *GeotagResponse {
+	if r.MaxGap <= 0 {
+		r.MaxGap = geotagDefaultMaxGap
+	}
+	if r.MaxGap > geotagMaxGapLimit {
+		c.JSON(http.StatusBadRequest, Response{"max_gap is too big"})
+		return nil
+	}
+	if r.TimeOffset < -maxTimeOffset || r.TimeOffset > maxTimeOffset {
+		c.JSON(http.StatusBadRequest, Response{"Invalid time offset"})
+		return nil
+	}
+	track, err := locations.ParseTrack([]byte(r.Track))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return nil
+	}
+	// Rough range first, then the exact matching below
+	margin := r.MaxGap + max(r.TimeOffset, -r.TimeOffset)
+	tx := db.Instance.
+		Where("user_id = ? and deleted=0 and size>0 and group_id is null and (gps_lat is null or gps_long is null)", user.ID).
+		Where("created_at between ? and ?", track.Start()-margin, track.End()+margin)
+	if len(r.IDs) > 0 {
+		tx = tx.Where("id in (?)", r.IDs)
+	}
+	assets := []models.Asset{}
+	if err = tx.Order("created_at").Find(&assets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return nil
+	}
+	result := GeotagResponse{
+		Start:   track.Start(),
+		End:     track.End(),
+		Matches: []GeotagMatch{},
+	}
+	for _, asset := range assets {
+		created := asset.CreatedAt
+		if asset.TimeOffset == nil {
+			// Camera's local time was saved as is
+			created -= r.TimeOffset
+		}
+		if lat, long, ok := track.Locate(created, r.MaxGap); ok {
+			result.Matches = append(result.Matches, GeotagMatch{
+				ID:      asset.ID,
+				Created: created,
+				GpsLat:  lat,
+				GpsLong: long,
+				setTime: asset.TimeOffset == nil && r.TimeOffset != 0,
+			})
+		}
+	}
+	return &result
+}
+
+// GeotagPreview returns the locations that would be set from the given track, without changing anything
+func GeotagPreview(c *gin.Context, user *models.User) {
+	r := GeotagRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	result := geotagMatches(c, user, &r)
+	if result == nil {
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GeotagApply sets the locations from the given track, places are then resolved by the location task
+func GeotagApply(c *gin.Context, user *models.User) {
+	r := GeotagRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	result := geotagMatches(c, user, &r)
+	if result == nil {
+		return
+	}
+	ids := []uint64{}
+	for _, m := range result.Matches {
+		updates := map[string]any{"gps_lat": m.GpsLat, "gps_long": m.GpsLong, "gps_source": models.MetadataSourceTrack, "place_id": nil}
+		if m.setTime {
+			updates["created_at"] = m.Created
+			updates["time_offset"] = r.TimeOffset
+			updates["time_source"] = models.MetadataSourceUser
+		}
+		if err := db.Instance.Model(&models.Asset{ID: m.ID}).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, DBError2Response)
+			return
+		}
+		ids = append(ids, m.ID)
+	}
+	if err := processing.ResetTasks(ids, "location"); err != nil {
+		log.Printf("Error resetting location task after geotagging: %v", err)
+		c.JSON(http.StatusInternalServerError, DBError3Response)
+		return
+	}
+	requestWriteback(ids...)
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"server/config"
+	"server/db"
+	"server/locations"
+	"server/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type MapRequest struct {
+	BBox string `form:"bbox" binding:"required"` // west,south,east,north - west is bigger than east across the antimeridian
+	Zoom int    `form:"zoom"`                    // Map zoom level, 0 to 22
+}
+
+// MapResponse is a GeoJSON FeatureCollection with a Point feature per cluster
+type MapResponse struct {
+	Type     string       `json:"type"`
+	Features []MapFeature `json:"features"`
+}
+
+type MapFeature struct {
+	Type       string      `json:"type"`
+	BBox       [4]float64  `json:"bbox"` // Bounds of the cluster, to zoom into it
+	Geometry   MapGeometry `json:"geometry"`
+	Properties MapCluster  `json:"properties"`
+}
+
+type MapGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"` // Centroid as [long, lat]
+}
+
+type MapCluster struct {
+	Count   int    `json:"count"`
+	AssetID uint64 `json:"asset_id"` // The best asset, e.g. for the marker's thumbnail
+}
+
+// parseBBox parses "west,south,east,north"
+func parseBBox(s string) (bbox [4]float64, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return bbox, errors.New("bbox needs 4 values: west,south,east,north")
+	}
+	for i, part := range parts {
+		if bbox[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64); err != nil {
+			return bbox, errors.New("invalid bbox value: " + part)
+		}
+	}
+	if bbox[1] < -90 || bbox[3] > 90 || bbox[1] > bbox[3] || bbox[0] < -180 || bbox[0] > 180 || bbox[2] < -180 || bbox[2] > 180 {
+		return bbox, errors.New("invalid bbox")
+	}
+	return bbox, nil
+}
+
+// RealMapClusters responds with the clustered geotagged assets of tx (with the assets table joined) in the requested bounding box
+func RealMapClusters(c *gin.Context, tx *gorm.DB) {
+	r := MapRequest{}
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	bbox, err := parseBBox(r.BBox)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	tx = tx.Select("assets.id, assets.gps_lat, assets.gps_long, assets.created_at, ifnull(asset_qualities.score, 0)").
+		Joins("left join asset_qualities on asset_qualities.asset_id = assets.id").
+		Where("assets.deleted=0 and assets.size>0 and assets.thumb_size>0 and assets.gps_lat between ? and ?", bbox[1], bbox[3])
+	if bbox[0] <= bbox[2] {
+		tx = tx.Where("assets.gps_long between ? and ?", bbox[0], bbox[2])
+	} else {
+		tx = tx.Where("(assets.gps_long >= ? or assets.gps_long <= ?)", bbox[0], bbox[2])
+	}
+	if config.RAW_JPEG_PAIRING {
+		tx = tx.Where(NotPairedClause)
+	}
+	rows, err := tx.Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	defer rows.Close()
+	points := []locations.ClusterPoint{}
+	for rows.Next() {
+		p := locations.ClusterPoint{}
+		if err = rows.Scan(&p.ID, &p.Lat, &p.Long, &p.Created, &p.Score); err != nil {
+			c.JSON(http.StatusInternalServerError, DBError2Response)
+			return
+		}
+		points = append(points, p)
+	}
+	result := MapResponse{Type: "FeatureCollection", Features: []MapFeature{}}
+	for _, cluster := range locations.ClusterPoints(points, r.Zoom) {
+		result.Features = append(result.Features, MapFeature{
+			Type:       "Feature",
+			BBox:       [4]float64{cluster.MinLong, cluster.MinLat, cluster.MaxLong, cluster.MaxLat},
+			Geometry:   MapGeometry{Type: "Point", Coordinates: [2]float64{cluster.Long, cluster.Lat}},
+			Properties: MapCluster{Count: cluster.Count, AssetID: cluster.AssetID},
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// MapClusters returns the user's own geotagged assets, clustered for the map view
+func MapClusters(c *gin.Context, user *models.User) {
+	RealMapClusters(c, db.Instance.Table("assets").Where("assets.user_id = ?", user.ID))
+}
+
+// AlbumMapClusters returns the geotagged assets of an album (or the favourites if no album ID is given), clustered for the map view
+func AlbumMapClusters(c *gin.Context, user *models.User) {
+	r := AlbumIDRequest{}
+	_ = c.ShouldBindQuery(&r)
+
+	if r.AlbumID == 0 {
+		RealMapClusters(c, db.Instance.
+			Table("favourite_assets").
+			Joins("join assets on favourite_assets.asset_id = assets.id").
+			Where("favourite_assets.user_id = ?", user.ID))
+		return
+	}
+	// Own album or as a contributor
+	access := 0
+	db.Instance.Raw("select 1 from albums a left join album_contributors ac on (ac.album_id = a.id) where a.id = ? AND (a.user_id = ? OR ac.user_id = ?)", r.AlbumID, user.ID, user.ID).Scan(&access)
+	if access == 0 {
+		c.JSON(http.StatusUnauthorized, NopeResponse)
+		return
+	}
+	RealMapClusters(c, db.Instance.
+		Table("album_assets").
+		Joins("join assets on album_assets.asset_id = assets.id").
+		Where("album_assets.album_id = ?", r.AlbumID))
+}
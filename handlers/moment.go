@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
+	"server/config"
 	"server/db"
 	"server/models"
 	"server/utils"
@@ -19,6 +21,7 @@ type MomentInfo struct {
 	HeroAssetId uint64 `json:"hero_asset_id"`
 	Start       int64  `json:"start" form:"start" binding:"required"`
 	End         int64  `json:"end" form:"end" binding:"required"`
+	Exclude     string `json:"-" form:"exclude"` // Comma-separated asset classes to exclude, e.g. "screenshot,document"
 }
 
 func (m *MomentInfo) merge(a *MomentInfo) {
@@ -40,6 +43,16 @@ func (m *MomentInfo) merge(a *MomentInfo) {
 }
 
 func MomentList(c *gin.Context, user *models.User) {
+	args := []any{user.ID}
+	exclude := ""
+	classes := excludedClasses(c.Query("exclude"))
+	if len(classes) > 0 {
+		exclude = " and " + ExcludeClassesClause
+		args = append(args, models.AssetTagSourceClassify, classes)
+	}
+	if config.RAW_JPEG_PAIRING {
+		exclude += " and " + NotPairedClause
+	}
 	// TODO: Minimum number of assets for a location should be configurable (now 6 below)
 	rows, err := db.Instance.Raw(`
 	select date,
@@ -60,7 +73,7 @@ func MomentList(c *gin.Context, user *models.User) {
 		from   assets
 		where  user_id = ?
 				and deleted = 0
-				and place_id is not null
+				and place_id is not null`+exclude+`
 		group  by 2, 1
 		having cnt > 6
 		order  by 2, 1 desc) t
@@ -70,7 +83,7 @@ func MomentList(c *gin.Context, user *models.User) {
 		2
 	order  by 1 desc,
 		2
-	`, user.ID).Rows()
+	`, args...).Rows()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, DBError1Response)
 		return
@@ -94,9 +107,84 @@ func MomentList(c *gin.Context, user *models.User) {
 		result = append(result, momentInfo)
 		lastMoment = &result[len(result)-1]
 	}
+	// Replace the latest asset with the best one as a hero image (if quality scores are available)
+	if err = bestMomentAssets(user.ID, result, classes); err != nil {
+		log.Printf("Error loading best assets for moments of user %d: %v", user.ID, err)
+	}
 	c.JSON(http.StatusOK, result)
 }
 
+// bestMomentAssets sets the best scored asset as hero of each moment. One query loads the best asset per place and day,
+// only from the places and time ranges of the moments
+func bestMomentAssets(userID uint64, moments []MomentInfo, classes []string) error {
+	if len(moments) == 0 {
+		return nil
+	}
+	filter := "assets.user_id = ? and assets.deleted = 0"
+	args := []any{userID}
+	if len(classes) > 0 {
+		filter += " and " + ExcludeClassesClause
+		args = append(args, models.AssetTagSourceClassify, classes)
+	}
+	if config.RAW_JPEG_PAIRING {
+		filter += " and " + NotPairedClause
+	}
+	placeMoments := map[string][]int{}
+	ranges := make([]string, len(moments))
+	for i, m := range moments {
+		places := strings.Split(m.Places, ",")
+		for _, p := range places {
+			placeMoments[p] = append(placeMoments[p], i)
+		}
+		ranges[i] = "(assets.place_id in (?) and assets.created_at >= ? and assets.created_at <= ?)"
+		args = append(args, places, m.Start, m.End)
+	}
+	filter += " and (" + strings.Join(ranges, " or ") + ")"
+	rows, err := db.Instance.Raw(`
+	select assets.id,
+		assets.place_id,
+		assets.created_at,
+		asset_qualities.score
+	from   assets
+	join   asset_qualities
+		on asset_qualities.asset_id = assets.id
+	join   (select assets.place_id,
+				`+db.CreatedDateFunc+`         date,
+				max(asset_qualities.score) score
+		from   assets
+		join   asset_qualities
+			on asset_qualities.asset_id = assets.id
+		where  `+filter+`
+		group  by 1, 2) best
+		on best.place_id = assets.place_id
+			and best.date = `+db.CreatedDateFunc+`
+			and best.score = asset_qualities.score
+	where  `+filter, append(args, args...)...).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	scores := make([]float64, len(moments))
+	found := make([]bool, len(moments))
+	for rows.Next() {
+		var id uint64
+		var placeID string
+		var created int64
+		var score float64
+		if err = rows.Scan(&id, &placeID, &created, &score); err != nil {
+			return err
+		}
+		for _, i := range placeMoments[placeID] {
+			if created >= moments[i].Start && created <= moments[i].End && (!found[i] || score > scores[i]) {
+				moments[i].HeroAssetId = id
+				scores[i] = score
+				found[i] = true
+			}
+		}
+	}
+	return rows.Err()
+}
+
 func MomentAssets(c *gin.Context, user *models.User) {
 	r := MomentInfo{}
 	err := c.ShouldBindQuery(&r)
@@ -104,13 +192,19 @@ func MomentAssets(c *gin.Context, user *models.User) {
 		c.JSON(http.StatusBadRequest, Response{err.Error()})
 		return
 	}
-	rows, err := db.Instance.
+	tx := db.Instance.
 		Table("assets").
 		Select(AssetsSelectClause).
 		Joins("left join favourite_assets on favourite_assets.asset_id = assets.id").
 		Joins(LeftJoinForLocations).
-		Where("assets.user_id = ? and place_id in (?) and assets.deleted=0 and assets.created_at>=? and assets.created_at<=?", user.ID, strings.Split(r.Places, ","), r.Start, r.End).
-		Order("assets.created_at DESC").Rows()
+		Where("assets.user_id = ? and place_id in (?) and assets.deleted=0 and assets.created_at>=? and assets.created_at<=?", user.ID, strings.Split(r.Places, ","), r.Start, r.End)
+	if classes := excludedClasses(r.Exclude); len(classes) > 0 {
+		tx = tx.Where(ExcludeClassesClause, models.AssetTagSourceClassify, classes)
+	}
+	if config.RAW_JPEG_PAIRING {
+		tx = tx.Where(NotPairedClause)
+	}
+	rows, err := tx.Order("assets.created_at DESC").Rows()
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, DBError1Response)
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"server/db"
+	"server/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+type PersonRequest struct {
+	ID     uint64 `json:"id" binding:"required"`
+	Name   string `json:"name"`    // New name, for rename
+	Into   uint64 `json:"into"`    // Person to merge into, for merge
+	Hidden bool   `json:"hidden"`  // For hide
+	FaceID uint64 `json:"face_id"` // Avatar face, 0 to use the latest face
+}
+
+type FaceRejectRequest struct {
+	ID       uint64 `json:"id" binding:"required"` // Face ID
+	PersonID uint64 `json:"person_id"`             // Defaults to the currently assigned person
+}
+
+// loadPerson returns the user's person or nil after responding with an error
+func loadPerson(c *gin.Context, user *models.User, id uint64) *models.Person {
+	person := models.Person{ID: id}
+	if db.Instance.First(&person).Error != nil || person.UserID != user.ID {
+		c.JSON(http.StatusNotFound, NopeResponse)
+		return nil
+	}
+	return &person
+}
+
+// personAssetIDs returns the assets with faces of the given person
+func personAssetIDs(personID uint64) []uint64 {
+	assetIDs := []uint64{}
+	db.Instance.Model(&models.Face{}).Where("person_id = ?", personID).Distinct().Pluck("asset_id", &assetIDs)
+	return assetIDs
+}
+
+// PersonRename changes the name of a person, names are unique per user
+func PersonRename(c *gin.Context, user *models.User) {
+	r := PersonRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		c.JSON(http.StatusBadRequest, Response{"Empty person name"})
+		return
+	}
+	person := loadPerson(c, user, r.ID)
+	if person == nil {
+		return
+	}
+	existing := models.Person{}
+	if err := db.Instance.Where("user_id = ? and name = ? and id != ?", user.ID, r.Name, person.ID).Find(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	if existing.ID != 0 {
+		c.JSON(http.StatusBadRequest, Response{"A person with this name already exists, merge them instead"})
+		return
+	}
+	if err := db.Instance.Model(person).Update("name", r.Name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError2Response)
+		return
+	}
+	requestWriteback(personAssetIDs(person.ID)...)
+	c.JSON(http.StatusOK, FaceInfo{PersonID: person.ID, PersonName: r.Name, Hidden: person.Hidden})
+}
+
+// PersonMerge moves all faces of a person to another one and deletes the first person.
+// The shares move too, so other users keep access to their faces
+func PersonMerge(c *gin.Context, user *models.User) {
+	r := PersonRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	if r.Into == 0 || r.Into == r.ID {
+		c.JSON(http.StatusBadRequest, Response{"Invalid person to merge into"})
+		return
+	}
+	from := loadPerson(c, user, r.ID)
+	if from == nil {
+		return
+	}
+	into := loadPerson(c, user, r.Into)
+	if into == nil {
+		return
+	}
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		// Merged faces are no longer rejected for the target person
+		err := tx.Exec("delete from face_rejections where person_id=? and face_id in (select id from faces where person_id=?)", into.ID, from.ID).Error
+		if err != nil {
+			return err
+		}
+		// Move the rest of the rejections, without duplicates
+		err = tx.Exec("delete from face_rejections where person_id=? and face_id in (select face_id from (select face_id from face_rejections where person_id=?) tmp)", from.ID, into.ID).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Exec("update face_rejections set person_id=? where person_id=?", into.ID, from.ID).Error; err != nil {
+			return err
+		}
+		// Move the shares, without duplicates
+		err = tx.Exec("delete from person_shares where person_id=? and (user_id in (select user_id from (select user_id from person_shares where person_id=?) tmp) "+
+			"or group_id in (select group_id from (select group_id from person_shares where person_id=?) tmp2))", from.ID, into.ID, into.ID).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Exec("update person_shares set person_id=? where person_id=?", into.ID, from.ID).Error; err != nil {
+			return err
+		}
+		if err = tx.Exec("update faces set person_id=? where person_id=?", into.ID, from.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(from).Error
+	})
+	if err != nil {
+		log.Printf("Error merging person ID %d into %d: %v", from.ID, into.ID, err)
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	requestWriteback(personAssetIDs(into.ID)...)
+	c.JSON(http.StatusOK, FaceInfo{PersonID: into.ID, PersonName: into.Name, Hidden: into.Hidden})
+}
+
+// PersonHide hides (or shows again) a person, e.g. a stranger. Faces are still assigned to hidden people, so they're not suggested again
+func PersonHide(c *gin.Context, user *models.User) {
+	r := PersonRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	person := loadPerson(c, user, r.ID)
+	if person == nil {
+		return
+	}
+	if err := db.Instance.Model(person).Update("hidden", r.Hidden).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	c.JSON(http.StatusOK, FaceInfo{PersonID: person.ID, PersonName: person.Name, Hidden: r.Hidden})
+}
+
+// PersonSetAvatar sets the face shown for the person (e.g. in the people list)
+func PersonSetAvatar(c *gin.Context, user *models.User) {
+	r := PersonRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	person := loadPerson(c, user, r.ID)
+	if person == nil {
+		return
+	}
+	var avatarID *uint64
+	if r.FaceID != 0 {
+		face := models.Face{}
+		if err := db.Instance.Select("id", "person_id").Where("id = ?", r.FaceID).Find(&face).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, DBError1Response)
+			return
+		}
+		if face.ID == 0 || face.PersonID == nil || *face.PersonID != person.ID {
+			c.JSON(http.StatusBadRequest, Response{"The face is not assigned to this person"})
+			return
+		}
+		avatarID = &face.ID
+	}
+	if err := db.Instance.Model(person).Update("avatar_face_id", avatarID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError2Response)
+		return
+	}
+	c.JSON(http.StatusOK, OKResponse)
+}
+
+// PersonDelete deletes a person, their faces become unassigned
+func PersonDelete(c *gin.Context, user *models.User) {
+	r := PersonRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	person := loadPerson(c, user, r.ID)
+	if person == nil {
+		return
+	}
+	assetIDs := personAssetIDs(person.ID)
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		// Not relying on cascades, as foreign keys may be disabled
+		if err := tx.Exec("update faces set person_id=null, distance=0 where person_id=?", person.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("delete from face_rejections where person_id=?", person.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("delete from person_shares where person_id=?", person.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(person).Error
+	})
+	if err != nil {
+		log.Printf("Error deleting person ID %d: %v", person.ID, err)
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	requestWriteback(assetIDs...)
+	c.JSON(http.StatusOK, OKResponse)
+}
+
+// FaceReject marks a face as "not this person": it's unassigned from them and not assigned to them automatically again
+func FaceReject(c *gin.Context, user *models.User) {
+	r := FaceRejectRequest{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	face := models.Face{}
+	if db.Instance.Select("id", "user_id", "asset_id", "person_id").Where("id = ?", r.ID).Find(&face).Error != nil || face.ID == 0 || face.UserID != user.ID {
+		c.JSON(http.StatusNotFound, NopeResponse)
+		return
+	}
+	if r.PersonID == 0 {
+		if face.PersonID == nil {
+			c.JSON(http.StatusBadRequest, Response{"The face is not assigned to a person"})
+			return
+		}
+		r.PersonID = *face.PersonID
+	}
+	// Own people or ones shared with the user, as faces are assigned to both
+	if !models.CanAccessPerson(user.ID, r.PersonID) {
+		c.JSON(http.StatusNotFound, NopeResponse)
+		return
+	}
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		rejection := models.FaceRejection{FaceID: face.ID, PersonID: r.PersonID}
+		if err := tx.Where(&rejection, "face_id", "person_id").FirstOrCreate(&rejection).Error; err != nil {
+			return err
+		}
+		return tx.Exec("update faces set person_id=null, distance=0 where id=? and person_id=?", face.ID, r.PersonID).Error
+	})
+	if err != nil {
+		log.Printf("Error rejecting face ID %d for person ID %d: %v", face.ID, r.PersonID, err)
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	requestWriteback(face.AssetID)
+	c.JSON(http.StatusOK, OKResponse)
+}
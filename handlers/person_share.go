@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"server/config"
+	"server/db"
+	"server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+type PersonSharesRequest struct {
+	ID uint64 `form:"id" binding:"required"`
+}
+
+type PersonShares struct {
+	ID     uint64   `json:"id" binding:"required"`
+	Users  []uint64 `json:"users"`
+	Groups []uint64 `json:"groups"`
+}
+
+type PersonAssetsRequest struct {
+	ID uint64 `form:"id" binding:"required"`
+}
+
+// PersonSharesGet returns the users and groups an own person is shared with
+func PersonSharesGet(c *gin.Context, user *models.User) {
+	r := PersonSharesRequest{}
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	person := loadPerson(c, user, r.ID)
+	if person == nil {
+		return
+	}
+	shares := []models.PersonShare{}
+	if err := db.Instance.Where("person_id = ?", person.ID).Order("id").Find(&shares).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	result := PersonShares{ID: person.ID, Users: []uint64{}, Groups: []uint64{}}
+	for _, share := range shares {
+		if share.UserID != nil {
+			result.Users = append(result.Users, *share.UserID)
+		}
+		if share.GroupID != nil {
+			result.Groups = append(result.Groups, *share.GroupID)
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// PersonSharesSave replaces the users and groups an own person is shared with.
+// Faces of users that lose access to the person are unassigned
+func PersonSharesSave(c *gin.Context, user *models.User) {
+	r := PersonShares{}
+	if err := c.ShouldBindWith(&r, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	person := loadPerson(c, user, r.ID)
+	if person == nil {
+		return
+	}
+	if len(r.Groups) > 0 {
+		// Only groups the user is a member of
+		var count int64
+		if err := db.Instance.Model(&models.GroupUser{}).Where("user_id = ? and group_id in (?)", user.ID, r.Groups).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, DBError1Response)
+			return
+		}
+		if count != int64(len(r.Groups)) {
+			c.JSON(http.StatusUnauthorized, NopeResponse)
+			return
+		}
+	}
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("person_id = ?", person.ID).Delete(&models.PersonShare{}).Error; err != nil {
+			return err
+		}
+		for _, userID := range r.Users {
+			if userID == user.ID {
+				continue
+			}
+			if err := tx.Create(&models.PersonShare{PersonID: person.ID, UserID: &userID}).Error; err != nil {
+				return err
+			}
+		}
+		for _, groupID := range r.Groups {
+			if err := tx.Create(&models.PersonShare{PersonID: person.ID, GroupID: &groupID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error sharing person ID %d: %v", person.ID, err)
+		c.JSON(http.StatusInternalServerError, DBError2Response)
+		return
+	}
+	// Other users' faces can only stay assigned while they have access
+	userIDs := []uint64{}
+	db.Instance.Model(&models.Face{}).Where("person_id = ? and user_id != ?", person.ID, user.ID).Distinct().Pluck("user_id", &userIDs)
+	for _, userID := range userIDs {
+		if models.CanAccessPerson(userID, person.ID) {
+			continue
+		}
+		assetIDs := []uint64{}
+		db.Instance.Model(&models.Face{}).Where("person_id = ? and user_id = ?", person.ID, userID).Distinct().Pluck("asset_id", &assetIDs)
+		if err = db.Instance.Exec("update faces set person_id=null, distance=0 where person_id=? and user_id=?", person.ID, userID).Error; err != nil {
+			log.Printf("Error unassigning faces of user %d from person ID %d: %v", userID, person.ID, err)
+			c.JSON(http.StatusInternalServerError, DBError3Response)
+			return
+		}
+		requestWriteback(assetIDs...)
+	}
+	c.JSON(http.StatusOK, OKResponse)
+}
+
+// PersonAssets returns the assets with the person (own or shared), from all assets the user can access:
+// own ones and ones in own or contributed albums. Other users' private assets are never included
+func PersonAssets(c *gin.Context, user *models.User) {
+	r := PersonAssetsRequest{}
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	if !models.CanAccessPerson(user.ID, r.ID) {
+		c.JSON(http.StatusNotFound, NopeResponse)
+		return
+	}
+	tx := db.Instance.
+		Table("assets").
+		Select(AssetsSelectClause).
+		Joins("left join favourite_assets on favourite_assets.asset_id = assets.id").
+		Joins(LeftJoinForLocations).
+		Where("exists (select 1 from faces where faces.asset_id = assets.id and faces.person_id = ?)", r.ID).
+		Where("assets.deleted=0 and assets.size>0 and assets.thumb_size>0 and "+AccessibleAssetsClause, user.ID, user.ID, user.ID)
+	if config.RAW_JPEG_PAIRING {
+		tx = tx.Where(NotPairedClause)
+	}
+	rows, err := tx.Order("assets.created_at DESC").Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	defer rows.Close()
+	result := LoadAssetsFromRows(c, rows)
+	if result == nil {
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"server/db"
+	"server/models"
+	"server/processing"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type ProcessingHookDeleteRequest struct {
+	ID uint64 `json:"id" binding:"required"`
+}
+
+func ProcessingHookList(c *gin.Context, user *models.User) {
+	hooks := []models.ProcessingHook{}
+	if err := db.Instance.Order("id ASC").Find(&hooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+func ProcessingHookSave(c *gin.Context, user *models.User) {
+	hook := models.ProcessingHook{}
+	err := c.ShouldBindWith(&hook, binding.JSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	hook.Name = cleanupName(hook.Name)
+	hook.Target = strings.TrimSpace(hook.Target)
+	if hook.Name == "" {
+		c.JSON(http.StatusBadRequest, Response{"Empty hook name"})
+		return
+	}
+	if hook.Type == models.ProcessingHookCommand {
+		if !filepath.IsAbs(hook.Target) {
+			c.JSON(http.StatusBadRequest, Response{"Command must be an absolute path"})
+			return
+		}
+	} else if hook.Type == models.ProcessingHookWebhook {
+		if !strings.HasPrefix(hook.Target, "http://") && !strings.HasPrefix(hook.Target, "https://") {
+			c.JSON(http.StatusBadRequest, Response{"Webhook must be an http(s) URL"})
+			return
+		}
+	} else {
+		c.JSON(http.StatusBadRequest, Response{"'type' must be one of 'command' or 'webhook'"})
+		return
+	}
+	if hook.Timeout == 0 {
+		hook.Timeout = models.DefaultProcessingHookTimeout
+	}
+	if hook.ID == 0 {
+		err = db.Instance.Create(&hook).Error
+	} else {
+		existing := models.ProcessingHook{}
+		if err = db.Instance.Where("id = ?", hook.ID).Find(&existing).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, DBError1Response)
+			return
+		}
+		if existing.ID == 0 {
+			c.JSON(http.StatusNotFound, NopeResponse)
+			return
+		}
+		err = db.Instance.Select("*").Omit("created_at").Updates(&hook).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{err.Error()})
+		return
+	}
+	if !hook.Enabled {
+		// Disabled hooks don't count as performed tasks, re-enabling runs them again
+		if err = processing.ForgetTask(hook.TaskName()); err != nil {
+			log.Printf("Error resetting hook %d status: %v", hook.ID, err)
+		}
+	}
+	c.JSON(http.StatusOK, hook)
+}
+
+func ProcessingHookDelete(c *gin.Context, user *models.User) {
+	req := ProcessingHookDeleteRequest{}
+	if err := c.ShouldBindWith(&req, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	hook := models.ProcessingHook{ID: req.ID}
+	if err := db.Instance.Delete(&hook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	// Remove everything the hook produced
+	source := hook.TaskName()
+	if db.Instance.Where("source = ?", source).Delete(&models.AssetTag{}).Error != nil ||
+		db.Instance.Where("source = ?", source).Delete(&models.AssetMetadata{}).Error != nil {
+		c.JSON(http.StatusInternalServerError, DBError2Response)
+		return
+	}
+	if err := processing.ForgetTask(source); err != nil {
+		log.Printf("Error resetting hook %d status: %v", hook.ID, err)
+		c.JSON(http.StatusInternalServerError, DBError3Response)
+		return
+	}
+	c.JSON(http.StatusOK, OKResponse)
+}
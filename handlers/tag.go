@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"server/config"
 	"server/db"
 	"server/models"
 	"server/utils"
@@ -21,6 +22,15 @@ const (
 	tagTypeType      = 7
 	tagTypeFavourite = 8
 	tagTypeAlbum     = 9
+	tagTypeCamera    = 10
+	tagTypeLens      = 11
+	tagTypeFocal     = 12
+	tagTypeISO       = 13
+	tagTypeAperture  = 14
+	tagTypeShutter   = 15
+	tagTypeCustom    = 16 // Tags added by processing hooks
+	tagTypeClass     = 17 // Screenshot, panorama, 360, portrait, document
+	tagTypeLabel     = 18 // Image classifier labels, e.g. "beach", "dog"
 )
 
 type Tag struct {
@@ -72,9 +82,15 @@ func TagList(c *gin.Context, user *models.User) {
 	if c.Query("reload") != "1" && isNotModified(c, tx) {
 		return
 	}
-	rows, err := db.Instance.Table("assets").Select("id, mime_type, favourite, created_at, locations.gps_lat, locations.gps_long, area, city, country").
-		Where("user_id=? AND deleted=0 AND size>0 AND thumb_size>0", user.ID).
+	notPaired := ""
+	if config.RAW_JPEG_PAIRING {
+		notPaired = " AND " + NotPairedClause
+	}
+	rows, err := db.Instance.Table("assets").Select("id, mime_type, favourite, created_at, locations.gps_lat, locations.gps_long, area, city, country, "+
+		"make, model, lens_model, focal_length, iso, f_number, exposure_time").
+		Where("user_id=? AND deleted=0 AND size>0 AND thumb_size>0"+notPaired, user.ID).
 		Joins(LeftJoinForLocations).
+		Joins("left join asset_exifs on asset_exifs.asset_id = assets.id").
 		Order("created_at DESC").
 		Rows()
 	if err != nil {
@@ -88,9 +104,13 @@ func TagList(c *gin.Context, user *models.User) {
 	var createdAt int64
 	var gpsLat, gpsLong *float64
 	var area, city, country *string
+	var cameraMake, cameraModel, lens *string
+	var focalLength, fNumber, exposureTime *float64
+	var iso *int
 	favourite := false
 	for rows.Next() {
-		if err = rows.Scan(&assetId, &mimeType, &favourite, &createdAt, &gpsLat, &gpsLong, &area, &city, &country); err != nil {
+		if err = rows.Scan(&assetId, &mimeType, &favourite, &createdAt, &gpsLat, &gpsLong, &area, &city, &country,
+			&cameraMake, &cameraModel, &lens, &focalLength, &iso, &fNumber, &exposureTime); err != nil {
 			c.JSON(http.StatusInternalServerError, DBError2Response)
 			return
 		}
@@ -120,9 +140,58 @@ func TagList(c *gin.Context, user *models.User) {
 		if favourite {
 			tags.add(tagTypeFavourite, "Favourite", assetId)
 		}
+		// Add camera and exposure tags, e.g. "Canon EOS R5", "f/1.8", "1/250"
+		if cameraModel != nil {
+			exif := models.AssetExif{Make: *cameraMake, Model: *cameraModel, LensModel: *lens, FocalLength: *focalLength, ISO: *iso, FNumber: *fNumber, ExposureTime: *exposureTime}
+			tags.add(tagTypeCamera, exif.GetCamera(), assetId)
+			tags.add(tagTypeLens, exif.LensModel, assetId)
+			tags.add(tagTypeFocal, exif.GetFocalLength(), assetId)
+			tags.add(tagTypeISO, exif.GetISO(), assetId)
+			tags.add(tagTypeAperture, exif.GetAperture(), assetId)
+			tags.add(tagTypeShutter, exif.GetShutterSpeed(), assetId)
+		}
+	}
+	// Add asset classes and tags from processing hooks
+	rows, err = db.Instance.Table("asset_tags").Select("asset_tags.asset_id, asset_tags.source, asset_tags.name").
+		Joins("join assets on assets.id = asset_tags.asset_id").
+		Where("assets.user_id=? AND assets.deleted=0 AND assets.size>0 AND assets.thumb_size>0"+notPaired, user.ID).
+		Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, DBError3Response)
+		return
+	}
+	defer rows.Close()
+	tagSource, tagName := "", ""
+	for rows.Next() {
+		if err = rows.Scan(&assetId, &tagSource, &tagName); err != nil {
+			c.JSON(http.StatusInternalServerError, DBError4Response)
+			return
+		}
+		if tagSource == models.AssetTagSourceClassify {
+			tags.add(tagTypeClass, tagName, assetId)
+		} else {
+			tags.add(tagTypeCustom, tagName, assetId)
+		}
+	}
+	// Add image labels, e.g. "beach", "dog"
+	rows, err = db.Instance.Table("asset_labels").Select("asset_labels.asset_id, asset_labels.name").
+		Joins("join assets on assets.id = asset_labels.asset_id").
+		Where("assets.user_id=? AND assets.deleted=0 AND assets.size>0 AND assets.thumb_size>0 AND asset_labels.confidence>=?"+notPaired, user.ID, config.LABEL_MIN_CONFIDENCE).
+		Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, DBError3Response)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = rows.Scan(&assetId, &tagName); err != nil {
+			c.JSON(http.StatusInternalServerError, DBError4Response)
+			return
+		}
+		tags.add(tagTypeLabel, tagName, assetId)
 	}
-	// Find all people, all their faces in assets and add them as tags
-	rows, err = db.Instance.Raw("select p.id, p.name, f.asset_id from people p join faces f on f.person_id=p.id").Rows()
+	// Find all people (own or shared), all their faces in own assets and add them as tags
+	rows, err = db.Instance.Raw("select p.id, p.name, f.asset_id from people p join faces f on f.person_id=p.id join assets on assets.id=f.asset_id where f.user_id=? and p.hidden=?"+notPaired, user.ID, false).Rows()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, DBError3Response)
 		return
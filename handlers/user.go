@@ -40,6 +40,7 @@ type UserStatusResponse struct {
 	BucketUsage      int64  `json:"bucket_usage"`
 	BucketQuota      int64  `json:"bucket_quota"`
 	GaodeMapsEnabled bool   `json:"gaode_maps_enabled,omitempty"`
+	VideoProfileID   uint64 `json:"video_profile_id"` // 0 for the default profile
 }
 
 type UserSaveResponse struct {
@@ -108,6 +109,9 @@ func newUserStatusResponse(user *models.User, details bool) UserStatusResponse {
 			user.SetNewPushToken()
 		}
 		result.PushToken = user.PushToken
+		if user.VideoProfileID != nil {
+			result.VideoProfileID = *user.VideoProfileID
+		}
 		result.BucketQuota = user.Quota
 		result.BucketUsage = user.GetUsage()
 		if result.BucketQuota == 0 {
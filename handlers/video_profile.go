@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"server/db"
+	"server/models"
+	"server/processing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type VideoProfileDeleteRequest struct {
+	ID uint64 `json:"id" binding:"required"`
+}
+
+type UserVideoProfileRequest struct {
+	ProfileID   uint64 `json:"profile_id"` // 0 for the default profile
+	Retranscode bool   `json:"retranscode"`
+}
+
+func VideoProfileList(c *gin.Context, user *models.User) {
+	profiles := []models.VideoProfile{}
+	if err := db.Instance.Order("name ASC").Find(&profiles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	c.JSON(http.StatusOK, profiles)
+}
+
+func VideoProfileSave(c *gin.Context, user *models.User) {
+	profile := models.VideoProfile{}
+	err := c.ShouldBindWith(&profile, binding.JSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	profile.Name = cleanupName(profile.Name)
+	if profile.Name == "" {
+		c.JSON(http.StatusBadRequest, Response{"Empty profile name"})
+		return
+	}
+	if !profile.IsValidCodec() {
+		c.JSON(http.StatusBadRequest, Response{"'codec' must be one of 'h264', 'hevc' or 'av1'"})
+		return
+	}
+	if profile.CRF > profile.MaxCRF() {
+		c.JSON(http.StatusBadRequest, Response{"'crf' is too high for this codec"})
+		return
+	}
+	if profile.AudioBitrate == 0 {
+		profile.AudioBitrate = models.DefaultVideoProfile.AudioBitrate
+	}
+	changed := false
+	if profile.ID == 0 {
+		profile.Version = 0
+		err = db.Instance.Create(&profile).Error
+	} else {
+		existing := models.VideoProfile{}
+		if err = db.Instance.Where("id = ?", profile.ID).Find(&existing).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, DBError1Response)
+			return
+		}
+		if existing.ID == 0 {
+			c.JSON(http.StatusNotFound, NopeResponse)
+			return
+		}
+		profile.Version = existing.Version
+		if !profile.SameEncoding(&existing) {
+			profile.Version++
+			changed = true
+		}
+		err = db.Instance.Select("*").Omit("created_at").Updates(&profile).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{err.Error()})
+		return
+	}
+	if changed {
+		if err = retranscodeProfileVideos(profile.ID); err != nil {
+			log.Printf("Error resetting video tasks for profile %d: %v", profile.ID, err)
+			c.JSON(http.StatusInternalServerError, DBError2Response)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// retranscodeProfileVideos queues the videos converted with an older version of the profile.
+// Only videos with a kept original are converted again, see videoConvert.shouldHandle
+func retranscodeProfileVideos(profileID uint64) error {
+	ids := []uint64{}
+	err := db.Instance.Model(&models.Asset{}).
+		Joins("join users on users.id = assets.user_id").
+		Where("users.video_profile_id = ? and assets.deleted = 0 and assets.mime_type like 'video/%' and assets.original_path != ''", profileID).
+		Pluck("assets.id", &ids).Error
+	if err != nil {
+		return err
+	}
+	return processing.ResetTasks(ids, "videoConvert")
+}
+
+func VideoProfileDelete(c *gin.Context, user *models.User) {
+	req := VideoProfileDeleteRequest{}
+	if err := c.ShouldBindWith(&req, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	// Users of this profile fall back to the default one (on delete set null)
+	if err := db.Instance.Delete(&models.VideoProfile{}, req.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	c.JSON(http.StatusOK, OKResponse)
+}
+
+// UserVideoProfileSave sets the video profile for the current user and optionally re-transcodes existing videos
+func UserVideoProfileSave(c *gin.Context, user *models.User) {
+	req := UserVideoProfileRequest{}
+	if err := c.ShouldBindWith(&req, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, Response{err.Error()})
+		return
+	}
+	user.VideoProfileID = nil
+	if req.ProfileID != 0 {
+		profile := models.VideoProfile{}
+		if err := db.Instance.First(&profile, req.ProfileID).Error; err != nil {
+			c.JSON(http.StatusNotFound, NopeResponse)
+			return
+		}
+		user.VideoProfileID = &profile.ID
+	}
+	if err := db.Instance.Model(user).Update("video_profile_id", user.VideoProfileID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, DBError1Response)
+		return
+	}
+	if req.Retranscode {
+		ids := []uint64{}
+		if err := db.Instance.Model(&models.Asset{}).Where("user_id = ? and deleted = 0 and mime_type like 'video/%'", user.ID).Pluck("id", &ids).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, DBError2Response)
+			return
+		}
+		// The conversion task decides per asset if the profile has actually changed
+		if err := processing.ResetTasks(ids, "videoConvert"); err != nil {
+			log.Printf("Error resetting video tasks for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, DBError3Response)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, OKResponse)
+}
@@ -0,0 +1,79 @@
+package locations
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	MaxZoom = 22
+
+	tileSize        = 256 // Pixels of a map tile
+	clusterCellSize = 64  // Pixels, points closer than that on screen are (usually) clustered
+	mercatorMaxLat  = 85.0511287798
+)
+
+// ClusterPoint is a geotagged asset, the best scored (then the newest) one represents its cluster
+type ClusterPoint struct {
+	ID      uint64
+	Lat     float64
+	Long    float64
+	Created int64
+	Score   float64
+}
+
+// Cluster is a group of points close to each other at some zoom level
+type Cluster struct {
+	Count   int
+	Lat     float64 // Centroid
+	Long    float64
+	AssetID uint64 // Representative point
+	MinLat  float64
+	MinLong float64
+	MaxLat  float64
+	MaxLong float64
+	best    *ClusterPoint
+}
+
+// ClusterPoints groups the points in a grid with cells of the same size on screen (Web Mercator, as used by map tiles).
+// The biggest clusters are first
+func ClusterPoints(points []ClusterPoint, zoom int) []Cluster {
+	zoom = min(max(zoom, 0), MaxZoom)
+	cell := clusterCellSize / (tileSize * math.Exp2(float64(zoom)))
+	index := map[[2]int64]int{}
+	result := []Cluster{}
+	for i := range points {
+		p := &points[i]
+		x, y := mercator(p.Lat, p.Long)
+		key := [2]int64{int64(math.Floor(x / cell)), int64(math.Floor(y / cell))}
+		n, ok := index[key]
+		if !ok {
+			n = len(result)
+			index[key] = n
+			result = append(result, Cluster{MinLat: p.Lat, MinLong: p.Long, MaxLat: p.Lat, MaxLong: p.Long})
+		}
+		c := &result[n]
+		c.Count++
+		// Running mean for the centroid
+		c.Lat += (p.Lat - c.Lat) / float64(c.Count)
+		c.Long += (p.Long - c.Long) / float64(c.Count)
+		c.MinLat, c.MaxLat = min(c.MinLat, p.Lat), max(c.MaxLat, p.Lat)
+		c.MinLong, c.MaxLong = min(c.MinLong, p.Long), max(c.MaxLong, p.Long)
+		if c.best == nil || p.Score > c.best.Score || (p.Score == c.best.Score && p.Created > c.best.Created) {
+			c.best = p
+			c.AssetID = p.ID
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Count > result[j].Count
+	})
+	return result
+}
+
+// mercator projects the coordinates to 0-1 on both axes
+func mercator(lat, long float64) (x, y float64) {
+	lat = min(max(lat, -mercatorMaxLat), mercatorMaxLat) * math.Pi / 180
+	x = (long + 180) / 360
+	y = (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2
+	return
+}
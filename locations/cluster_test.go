@@ -0,0 +1,44 @@
+package locations
+
+import "testing"
+
+func TestClusterPoints(t *testing.T) {
+	points := []ClusterPoint{
+		{ID: 1, Lat: 52.5200, Long: 13.4050, Created: 100, Score: 0.5},
+		{ID: 2, Lat: 52.5210, Long: 13.4060, Created: 200, Score: 0.5},
+		{ID: 3, Lat: 52.5150, Long: 13.3770, Created: 50, Score: 0.4},
+		{ID: 4, Lat: 48.8566, Long: 2.3522, Created: 300},
+	}
+	tests := []struct {
+		name string
+		zoom int
+		want []Cluster // Centroids are checked roughly
+	}{
+		{"world", 0, []Cluster{{Count: 4, AssetID: 2}}},
+		{"countries", 4, []Cluster{{Count: 3, AssetID: 2}, {Count: 1, AssetID: 4}}},
+		{"city", 12, []Cluster{{Count: 2, AssetID: 2}, {Count: 1, AssetID: 3}, {Count: 1, AssetID: 4}}},
+		{"street", 22, []Cluster{{Count: 1, AssetID: 1}, {Count: 1, AssetID: 2}, {Count: 1, AssetID: 3}, {Count: 1, AssetID: 4}}},
+		{"clamped", 100, []Cluster{{Count: 1, AssetID: 1}, {Count: 1, AssetID: 2}, {Count: 1, AssetID: 3}, {Count: 1, AssetID: 4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClusterPoints(points, tt.zoom)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ClusterPoints() = %d clusters, want %d", len(got), len(tt.want))
+			}
+			for i, c := range got {
+				if c.Count != tt.want[i].Count || c.AssetID != tt.want[i].AssetID {
+					t.Errorf("cluster %d = %d points, asset %d, want %d points, asset %d", i, c.Count, c.AssetID, tt.want[i].Count, tt.want[i].AssetID)
+				}
+				if c.Lat < c.MinLat || c.Lat > c.MaxLat || c.Long < c.MinLong || c.Long > c.MaxLong {
+					t.Errorf("cluster %d centroid %f, %f is out of its bounds", i, c.Lat, c.Long)
+				}
+			}
+		})
+	}
+
+	got := ClusterPoints(points[:2], 0)
+	if lat, long := got[0].Lat, got[0].Long; lat != 52.5205 || long < 13.40549 || long > 13.40551 {
+		t.Errorf("centroid = %f, %f, want 52.5205, 13.4055", lat, long)
+	}
+}
@@ -3,12 +3,9 @@ package locations
 import (
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"math"
-	"net/http"
+	"server/models"
 	"strings"
-	"time"
 )
 
 // WGS84(World) to GCJ02(China GPS) offline algo
@@ -58,32 +55,14 @@ func transformLon(x, y float64) float64 {
 	return ret
 }
 
-func GetGaodeLocation(lat, long float64, apiKey string) *NominatimLocation {
-	// Add throttling
-	if time.Since(lastRequest) < throttling {
-		time.Sleep(throttling - time.Since(lastRequest))
-	}
-	lastRequest = time.Now()
-	gcj02Long, gcj02Lat := wgs84ToGCJ02(long, lat)
-	url := fmt.Sprintf("https://restapi.amap.com/v3/geocode/regeo?key=%s&location=%f,%f&extensions=all&batch=false&roadlevel=0&output=JSON", apiKey, gcj02Long, gcj02Lat)
-	log.Printf("Making request to: %s", url)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("Failed request to:", url, err)
-		return nil
-	}
-	defer resp.Body.Close()
+// Gaode uses the Gaode (Amap) Maps API, OpenStreetMap services are not available in China
+type Gaode struct {
+	APIKey string
+}
 
-	// 读取响应体
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Println("Failed to read response body:", err)
-		return nil
-	}
+func (g *Gaode) Reverse(lat, long float64) (*models.Location, error) {
+	gcj02Long, gcj02Lat := wgs84ToGCJ02(long, lat)
+	url := fmt.Sprintf("https://restapi.amap.com/v3/geocode/regeo?key=%s&location=%f,%f&extensions=all&batch=false&roadlevel=0&output=JSON", g.APIKey, gcj02Long, gcj02Lat)
 
 	// China has municipalities directly under the central government, and the Amap API does not display their city names.
 	var gaodeResp struct {
@@ -103,15 +82,12 @@ func GetGaodeLocation(lat, long float64, apiKey string) *NominatimLocation {
 		} `json:"regeocode"`
 	}
 
-	if err = json.Unmarshal(body, &gaodeResp); err != nil {
-		log.Println("JSON decode error:", err)
-		log.Println("URL:", url)
-		return nil
+	if err := getJSON(url, map[string]string{"Accept-Language": "zh-CN,zh;q=0.9"}, &gaodeResp); err != nil {
+		return nil, err
 	}
 
 	if gaodeResp.Status != "1" {
-		log.Printf("Gaode API error: Status=%s, Info=%s", gaodeResp.Status, gaodeResp.Info)
-		return nil
+		return nil, fmt.Errorf("Gaode API error: Status=%s, Info=%s", gaodeResp.Status, gaodeResp.Info)
 	}
 
 	// Get City Name (Processing Municipality Logic)
@@ -199,5 +175,5 @@ func GetGaodeLocation(lat, long float64, apiKey string) *NominatimLocation {
 		result.DisplayName = strings.Join(parts, ", ")
 	}
 
-	return result
+	return result.toLocation(), nil
 }
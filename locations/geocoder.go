@@ -0,0 +1,123 @@
+package locations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"server/config"
+	"server/models"
+	"time"
+)
+
+const (
+	GeocoderNominatim = "nominatim"
+	GeocoderPhoton    = "photon"
+	GeocoderGaode     = "gaode"
+
+	geocoderTimeout   = 30 * time.Second
+	geocoderRetries   = 3
+	geocoderUserAgent = "circled.me server"
+)
+
+// Geocoder resolves coordinates to a location, only Display, Area, City, Country and CountryCode are set.
+// Nil without an error means nothing is there (e.g. in the middle of the ocean)
+type Geocoder interface {
+	Reverse(lat, long float64) (*models.Location, error)
+}
+
+var (
+	// Default is the configured geocoder
+	Default Geocoder
+	client  = http.Client{Timeout: geocoderTimeout}
+)
+
+// StatusError is an unexpected HTTP response status from a geocoding service
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("geocoding service error: %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// Init loads the offline data if configured and sets up the default geocoder
+func Init() {
+	name := config.GEOCODER
+	if name == "" {
+		name = GeocoderNominatim
+		if config.GAODE_API_KEY != "" {
+			name = GeocoderGaode
+		}
+	}
+	initOffline(name == GeocoderOffline)
+	interval := time.Duration(config.GEOCODER_INTERVAL * float64(time.Second))
+	switch name {
+	case GeocoderNominatim:
+		Default = NewLimiter(&Nominatim{BaseURL: config.NOMINATIM_URL, Language: config.GEOCODER_LANGUAGE}, interval)
+	case GeocoderPhoton:
+		Default = NewLimiter(&Photon{BaseURL: config.PHOTON_URL, Language: config.GEOCODER_LANGUAGE}, interval)
+	case GeocoderGaode:
+		if config.GAODE_API_KEY == "" {
+			log.Fatal("GAODE_API_KEY is needed for the gaode geocoder")
+		}
+		Default = NewLimiter(&Gaode{APIKey: config.GAODE_API_KEY}, interval)
+	case GeocoderOffline:
+		Default = offline
+	default:
+		log.Fatalf("Unknown geocoder: %s", config.GEOCODER)
+	}
+	log.Printf("Using geocoder: %s", name)
+}
+
+// Reverse resolves the coordinates with the default geocoder, the offline data (if loaded) is used as fallback.
+// Nil if nothing is found
+func Reverse(lat, long float64) *models.Location {
+	var result *models.Location
+	if Default != nil {
+		location, err := Default.Reverse(lat, long)
+		if err != nil {
+			log.Printf("Geocoding error for %f, %f: %v", lat, long, err)
+		}
+		result = location
+	}
+	if result == nil && offline != nil && Default != Geocoder(offline) {
+		result, _ = offline.Reverse(lat, long)
+	}
+	return result
+}
+
+// getJSON makes a GET request and decodes the JSON response into result
+func getJSON(u string, headers map[string]string, result any) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", geocoderUserAgent)
+	for name, value := range headers {
+		if value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Code: resp.StatusCode}
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// retryable returns true for network errors and temporary service errors (rate limiting, server errors)
+func retryable(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Code == http.StatusTooManyRequests || status.Code >= http.StatusInternalServerError
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
@@ -0,0 +1,137 @@
+package locations
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"server/models"
+	"testing"
+)
+
+func TestNominatimReverse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/reverse" || r.Header.Get("Accept-Language") != "de" || r.Header.Get("User-Agent") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("lat") == "0.000000" {
+			io.WriteString(w, `{"error": "Unable to geocode"}`)
+			return
+		}
+		io.WriteString(w, `{"display_name": "Kreuzberg, Berlin, Deutschland", "address": {"neighbourhood": "Kreuzberg", "city": "Berlin", "country": "Deutschland", "country_code": "de"}}`)
+	}))
+	defer server.Close()
+
+	n := &Nominatim{BaseURL: server.URL + "/", Language: "de"}
+	got, err := n.Reverse(52.5, 13.4)
+	if err != nil {
+		t.Fatalf("Reverse() error = %v", err)
+	}
+	want := models.Location{Display: "Kreuzberg, Berlin, Deutschland", Area: "Kreuzberg", City: "Berlin", Country: "Deutschland", CountryCode: "de"}
+	if got == nil || *got != want {
+		t.Errorf("Reverse() = %+v, want %+v", got, want)
+	}
+	if got, err = n.Reverse(0, 0); err != nil || got != nil {
+		t.Errorf("Reverse() = %+v, %v, want nothing found", got, err)
+	}
+}
+
+func TestPhotonReverse(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties string
+		want       models.Location
+	}{
+		{"street", `{"type": "street", "name": "Oranienstraße", "district": "Kreuzberg", "city": "Berlin", "state": "Berlin", "country": "Germany", "countrycode": "DE"}`,
+			models.Location{Display: "Oranienstraße, Kreuzberg, Berlin, Germany", Area: "Kreuzberg", City: "Berlin", Country: "Germany", CountryCode: "de"}},
+		{"city", `{"type": "city", "name": "Apia", "country": "Samoa", "countrycode": "WS"}`,
+			models.Location{Display: "Apia, Samoa", Area: "Apia", City: "Apia", Country: "Samoa", CountryCode: "ws"}},
+		{"rural", `{"type": "house", "name": "Farm", "county": "Landkreis Oder-Spree", "state": "Brandenburg", "country": "Germany", "countrycode": "DE"}`,
+			models.Location{Display: "Farm, Landkreis Oder-Spree, Brandenburg, Germany", Area: "Farm", City: "Landkreis Oder-Spree", Country: "Germany", CountryCode: "de"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/reverse" || r.URL.Query().Get("lang") != "en" || r.URL.Query().Get("lon") != "13.400000" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				io.WriteString(w, `{"type": "FeatureCollection", "features": [{"type": "Feature", "properties": `+tt.properties+`}]}`)
+			}))
+			defer server.Close()
+
+			got, err := (&Photon{BaseURL: server.URL, Language: "en"}).Reverse(52.5, 13.4)
+			if err != nil {
+				t.Fatalf("Reverse() error = %v", err)
+			}
+			if got == nil || *got != tt.want {
+				t.Errorf("Reverse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// flaky fails the first requests with the given error
+type flaky struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flaky) Reverse(lat, long float64) (*models.Location, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, f.err
+	}
+	return &models.Location{City: "Berlin"}, nil
+}
+
+func TestLimiterRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", 0, nil, 1, false},
+		{"rate limited", 2, &StatusError{Code: http.StatusTooManyRequests}, 3, false},
+		{"server errors", 5, &StatusError{Code: http.StatusBadGateway}, 4, true},
+		{"bad request", 1, &StatusError{Code: http.StatusBadRequest}, 1, true},
+		{"invalid response", 1, errors.New("invalid JSON"), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &flaky{failures: tt.failures, err: tt.err}
+			got, err := NewLimiter(f, 0).Reverse(52.5, 13.4)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Reverse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got == nil || got.City != "Berlin") {
+				t.Errorf("Reverse() = %+v", got)
+			}
+			if f.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", f.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestReverseFallback(t *testing.T) {
+	offline = testOffline(t, false)
+	defer func() { offline, Default = nil, nil }()
+
+	Default = &Stub{Location: &models.Location{City: "Somewhere"}}
+	if got := Reverse(52.52, 13.41); got == nil || got.City != "Somewhere" {
+		t.Errorf("Reverse() = %+v, want the default geocoder's location", got)
+	}
+	Default = &Stub{Err: &StatusError{Code: http.StatusServiceUnavailable}}
+	if got := Reverse(52.52, 13.41); got == nil || got.City != "Berlin" {
+		t.Errorf("Reverse() = %+v, want the offline location", got)
+	}
+	offline = nil
+	if got := Reverse(52.52, 13.41); got != nil {
+		t.Errorf("Reverse() = %+v, want nil", got)
+	}
+}
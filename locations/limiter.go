@@ -0,0 +1,41 @@
+package locations
+
+import (
+	"log"
+	"server/models"
+	"sync"
+	"time"
+)
+
+// Limiter queues requests to an online geocoder, so there's at most one request per interval
+// (as required by e.g. the public Nominatim instance), and retries failed requests with backoff
+type Limiter struct {
+	Geocoder Geocoder
+	Interval time.Duration
+	Retries  int
+	mu       sync.Mutex
+	last     time.Time
+}
+
+func NewLimiter(geocoder Geocoder, interval time.Duration) *Limiter {
+	return &Limiter{Geocoder: geocoder, Interval: interval, Retries: geocoderRetries}
+}
+
+func (l *Limiter) Reverse(lat, long float64) (*models.Location, error) {
+	// Callers wait for their turn here
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if wait := l.Interval - time.Since(l.last); wait > 0 {
+			time.Sleep(wait)
+		}
+		location, err := l.Geocoder.Reverse(lat, long)
+		l.last = time.Now()
+		if err == nil || attempt >= l.Retries || !retryable(err) {
+			return location, err
+		}
+		backoff := l.Interval << attempt
+		log.Printf("Geocoding attempt %d for %f, %f failed, retrying in %v: %v", attempt+1, lat, long, backoff, err)
+		time.Sleep(backoff)
+	}
+}
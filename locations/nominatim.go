@@ -1,23 +1,16 @@
 package locations
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
 	"server/models"
 	"strings"
-	"time"
 )
 
-var (
-	client      = http.Client{}
-	lastRequest = time.Now().Add(-10 * time.Second)
-)
-
-const (
-	throttling = 3 * time.Second
-)
+// Nominatim uses the OpenStreetMap Nominatim API, either the public instance or a self-hosted one
+type Nominatim struct {
+	BaseURL  string // e.g. https://nominatim.openstreetmap.org
+	Language string // Accept-Language, optional
+}
 
 type NominatimAddress struct {
 	Aeroway       string `json:"aeroway"`
@@ -75,30 +68,26 @@ func (n *NominatimLocation) GetArea() string {
 	return a[0] + "," + a[1]
 }
 
-func GetNominatimLocation(lat, long float64) *NominatimLocation {
-	// Add throttling
-	if time.Since(lastRequest) < throttling {
-		time.Sleep(throttling - time.Since(lastRequest))
+// toLocation normalizes the result, country codes are lower case
+func (n *NominatimLocation) toLocation() *models.Location {
+	return &models.Location{
+		Display:     n.DisplayName,
+		Area:        n.GetArea(),
+		City:        n.GetCity(),
+		Country:     n.Address.Country,
+		CountryCode: strings.ToLower(n.Address.CountryCode),
 	}
-	lastRequest = time.Now()
+}
 
-	url := fmt.Sprintf("https://nominatim.openstreetmap.org/reverse?format=json&lat=%f&lon=%f", lat, long)
-	log.Printf("Making request to: %s", url)
-	req, _ := http.NewRequest("GET", url, nil)
-	// TODO: not only English?
-	req.Header.Set("accept-language", "en")
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("Failed request to:", url, err)
-		return nil
+func (n *Nominatim) Reverse(lat, long float64) (*models.Location, error) {
+	url := fmt.Sprintf("%s/reverse?format=json&lat=%f&lon=%f", strings.TrimRight(n.BaseURL, "/"), lat, long)
+	result := NominatimLocation{}
+	if err := getJSON(url, map[string]string{"Accept-Language": n.Language}, &result); err != nil {
+		return nil, err
 	}
-	result := &NominatimLocation{}
-	decoder := json.NewDecoder(resp.Body)
-	defer resp.Body.Close()
-
-	if err = decoder.Decode(result); err != nil {
-		log.Println(url, err)
-		return nil
+	// Nothing found is an error response, without a display name
+	if result.DisplayName == "" {
+		return nil, nil
 	}
-	return result
+	return result.toLocation(), nil
 }
@@ -0,0 +1,365 @@
+package locations
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"server/config"
+	"server/models"
+	"strconv"
+	"strings"
+)
+
+const (
+	GeocoderOffline = "offline"
+
+	offlineMaxDistanceKm = 50 // Nothing is returned for places farther from any known city
+	offlineAreaMaxKm     = 3  // Neighbourhoods are only used as area if this close
+	earthRadiusKm        = 6371.0
+	kmPerDegree          = 111.2
+)
+
+var (
+	// Most detailed first
+	geoNamesCityFiles = []string{"cities500.txt", "cities1000.txt", "cities5000.txt", "cities15000.txt"}
+	// Offline is the loaded offline geocoder, nil if not configured
+	offline *Offline
+)
+
+type offlinePlace struct {
+	name          string
+	lat, long     float64
+	countryCode   string
+	admin1        string // Admin1 code, e.g. "CA" (the name is in Offline.admin1)
+	neighbourhood bool   // Section of a populated place (GeoNames feature code PPLX)
+}
+
+type countryBoundary struct {
+	code     string
+	name     string
+	polygons [][][][2]float64 // Polygons, each with outer ring and holes, as [long, lat] points
+	minLat   float64
+	maxLat   float64
+	minLong  float64
+	maxLong  float64
+}
+
+// Offline resolves locations from GeoNames data (https://download.geonames.org/export/dump/), without any network requests.
+// Country boundaries (e.g. Natural Earth admin 0 countries as GeoJSON) are optional, they help near borders
+type Offline struct {
+	places     []offlinePlace
+	grid       map[[2]int][]int32 // 1x1 degree cells -> places
+	countries  map[string]string  // Country code -> name
+	admin1     map[string]string  // "US.CA" -> "California"
+	boundaries []countryBoundary
+}
+
+// initOffline loads the offline data if configured, it's required for the offline geocoder and used as fallback otherwise
+func initOffline(required bool) {
+	if config.GEONAMES_DIR == "" {
+		if required {
+			log.Fatal("GEONAMES_DIR is needed for the offline geocoder")
+		}
+		return
+	}
+	if err := InitOffline(config.GEONAMES_DIR, config.GEO_BOUNDARIES_FILE); err != nil {
+		if required {
+			log.Fatalf("Cannot load the offline geocoder data: %v", err)
+		}
+		log.Printf("Cannot load the offline geocoder data, no fallback for online geocoding: %v", err)
+	}
+}
+
+// InitOffline loads the GeoNames files from dir and the (optional) boundaries GeoJSON file
+func InitOffline(dir, boundariesFile string) error {
+	o := &Offline{grid: map[[2]int][]int32{}, countries: map[string]string{}, admin1: map[string]string{}}
+	loaded := false
+	for _, name := range geoNamesCityFiles {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		err = o.loadCities(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		loaded = true
+		break
+	}
+	if !loaded {
+		return errors.New("no GeoNames cities file found in " + dir)
+	}
+	for name, load := range map[string]func(io.Reader) error{"countryInfo.txt": o.loadCountries, "admin1CodesASCII.txt": o.loadAdmin1} {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		err = load(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if boundariesFile != "" {
+		file, err := os.Open(boundariesFile)
+		if err != nil {
+			return err
+		}
+		err = o.loadBoundaries(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Offline geocoder loaded: %d places, %d country boundaries", len(o.places), len(o.boundaries))
+	offline = o
+	return nil
+}
+
+func (o *Offline) Reverse(lat, long float64) (*models.Location, error) {
+	result := o.Locate(lat, long)
+	if result == nil {
+		return nil, nil
+	}
+	return result.toLocation(), nil
+}
+
+// loadCities reads a GeoNames cities file: tab separated, with name at 1, lat/long at 4 and 5,
+// feature code at 7, country code at 8 and admin1 code at 10
+func (o *Offline) loadCities(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // Alternate names can be long
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 11 {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(fields[4], 64)
+		long, err2 := strconv.ParseFloat(fields[5], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		o.places = append(o.places, offlinePlace{
+			name:          fields[1],
+			lat:           lat,
+			long:          long,
+			countryCode:   fields[8],
+			admin1:        fields[10],
+			neighbourhood: fields[7] == "PPLX",
+		})
+		cell := gridCell(lat, long)
+		o.grid[cell] = append(o.grid[cell], int32(len(o.places)-1))
+	}
+	return scanner.Err()
+}
+
+// loadCountries reads GeoNames countryInfo.txt: ISO code at 0 and name at 4, comments start with #
+func (o *Offline) loadCountries(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fields := strings.Split(line, "\t"); len(fields) > 4 {
+			o.countries[fields[0]] = fields[4]
+		}
+	}
+	return scanner.Err()
+}
+
+// loadAdmin1 reads GeoNames admin1CodesASCII.txt: "US.CA", name, ASCII name, ID
+func (o *Offline) loadAdmin1(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if fields := strings.Split(scanner.Text(), "\t"); len(fields) > 1 {
+			o.admin1[fields[0]] = fields[1]
+		}
+	}
+	return scanner.Err()
+}
+
+// loadBoundaries reads country (Multi)Polygons from GeoJSON, using the ISO_A2 (or ISO_A2_EH) and NAME properties
+func (o *Offline) loadBoundaries(r io.Reader) error {
+	collection := struct {
+		Features []struct {
+			Properties map[string]any `json:"properties"`
+			Geometry   struct {
+				Type   string          `json:"type"`
+				Coords json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}{}
+	if err := json.NewDecoder(r).Decode(&collection); err != nil {
+		return err
+	}
+	for _, f := range collection.Features {
+		b := countryBoundary{minLat: 90, maxLat: -90, minLong: 180, maxLong: -180}
+		for _, key := range []string{"ISO_A2", "ISO_A2_EH", "iso_a2"} {
+			if code, _ := f.Properties[key].(string); len(code) == 2 {
+				b.code = code
+				break
+			}
+		}
+		for _, key := range []string{"NAME", "ADMIN", "name"} {
+			if name, _ := f.Properties[key].(string); name != "" {
+				b.name = name
+				break
+			}
+		}
+		switch f.Geometry.Type {
+		case "Polygon":
+			polygon := [][][2]float64{}
+			if json.Unmarshal(f.Geometry.Coords, &polygon) == nil {
+				b.polygons = append(b.polygons, polygon)
+			}
+		case "MultiPolygon":
+			_ = json.Unmarshal(f.Geometry.Coords, &b.polygons)
+		}
+		if b.code == "" || len(b.polygons) == 0 {
+			continue
+		}
+		for _, polygon := range b.polygons {
+			for _, ring := range polygon {
+				for _, p := range ring {
+					b.minLong, b.maxLong = min(b.minLong, p[0]), max(b.maxLong, p[0])
+					b.minLat, b.maxLat = min(b.minLat, p[1]), max(b.maxLat, p[1])
+				}
+			}
+		}
+		o.boundaries = append(o.boundaries, b)
+	}
+	return nil
+}
+
+// Locate returns the closest city (and neighbourhood) in the same country as the location
+func (o *Offline) Locate(lat, long float64) *NominatimLocation {
+	countryCode, boundaryName := o.countryAt(lat, long)
+	city, area := o.nearest(lat, long, countryCode)
+	if city < 0 && countryCode != "" {
+		// e.g. an island without cities in the data
+		boundaryName = ""
+		city, area = o.nearest(lat, long, "")
+	}
+	if city < 0 {
+		return nil
+	}
+	c := &o.places[city]
+	// GeoNames names are preferred, so they're the same with or without boundaries
+	countryName := o.countries[c.countryCode]
+	if countryName == "" {
+		countryName = boundaryName
+	}
+	result := &NominatimLocation{
+		Address: NominatimAddress{
+			City:        c.name,
+			Province:    o.admin1[c.countryCode+"."+c.admin1],
+			Country:     countryName,
+			CountryCode: strings.ToLower(c.countryCode),
+		},
+	}
+	parts := []string{}
+	if area >= 0 {
+		result.Address.Neighbourhood = o.places[area].name
+		parts = append(parts, result.Address.Neighbourhood)
+	}
+	for _, part := range []string{c.name, result.Address.Province, countryName} {
+		if part != "" && (len(parts) == 0 || parts[len(parts)-1] != part) {
+			parts = append(parts, part)
+		}
+	}
+	result.DisplayName = strings.Join(parts, ", ")
+	return result
+}
+
+// nearest returns the indexes of the closest city and neighbourhood (-1 if none), only in the given country if not empty
+func (o *Offline) nearest(lat, long float64, countryCode string) (city, area int) {
+	// Check all cells that can have places within the max distance
+	latCells := int(math.Ceil(offlineMaxDistanceKm / kmPerDegree))
+	longCells := int(math.Ceil(offlineMaxDistanceKm / (kmPerDegree * math.Max(math.Cos(lat*math.Pi/180), 0.01))))
+	longCells = min(longCells, 180)
+	center := gridCell(lat, long)
+	city, area = -1, -1
+	cityDistance, areaDistance := offlineMaxDistanceKm+1.0, offlineAreaMaxKm+1.0
+	for y := center[0] - latCells; y <= center[0]+latCells; y++ {
+		for x := center[1] - longCells; x <= center[1]+longCells; x++ {
+			// Longitude wraps around
+			cell := [2]int{y, (x%360+540)%360 - 180}
+			for _, i := range o.grid[cell] {
+				p := &o.places[i]
+				if countryCode != "" && p.countryCode != countryCode {
+					continue
+				}
+				d := distanceKm(lat, long, p.lat, p.long)
+				if p.neighbourhood {
+					if d < areaDistance {
+						area, areaDistance = int(i), d
+					}
+				} else if d < cityDistance {
+					city, cityDistance = int(i), d
+				}
+			}
+		}
+	}
+	return city, area
+}
+
+// countryAt returns the country whose boundary contains the location, if boundaries are loaded
+func (o *Offline) countryAt(lat, long float64) (code, name string) {
+	for i := range o.boundaries {
+		b := &o.boundaries[i]
+		if lat < b.minLat || lat > b.maxLat || long < b.minLong || long > b.maxLong {
+			continue
+		}
+		for _, polygon := range b.polygons {
+			if inPolygon(polygon, lat, long) {
+				return b.code, b.name
+			}
+		}
+	}
+	return "", ""
+}
+
+// inPolygon checks if the point is in the outer ring and not in any of the holes
+func inPolygon(polygon [][][2]float64, lat, long float64) bool {
+	if len(polygon) == 0 || !inRing(polygon[0], lat, long) {
+		return false
+	}
+	for _, hole := range polygon[1:] {
+		if inRing(hole, lat, long) {
+			return false
+		}
+	}
+	return true
+}
+
+// inRing uses ray casting, points are [long, lat]
+func inRing(ring [][2]float64, lat, long float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > lat) != (b[1] > lat) && long < (b[0]-a[0])*(lat-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func gridCell(lat, long float64) [2]int {
+	return [2]int{int(math.Floor(lat)), int(math.Floor(long))}
+}
+
+// distanceKm returns the great-circle distance (haversine formula)
+func distanceKm(lat1, long1, lat2, long2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLong := (long2 - long1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
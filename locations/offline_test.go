@@ -0,0 +1,123 @@
+package locations
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	// name, lat, long, feature code, country code, admin1 (other columns are not used)
+	testCities = "2950159\tBerlin\tBerlin\t\t52.52437\t13.41053\tP\tPPLC\tDE\t\t16\t\t\t\t3426354\t\t74\tEurope/Berlin\t2024-01-01\n" +
+		"2947421\tKreuzberg\tKreuzberg\t\t52.49973\t13.40338\tP\tPPLX\tDE\t\t16\t\t\t\t147227\t\t\tEurope/Berlin\t2024-01-01\n" +
+		"3081368\tSłubice\tSlubice\t\t52.35\t14.56667\tP\tPPL\tPL\t\t76\t\t\t\t16833\t\t\tEurope/Warsaw\t2024-01-01\n" +
+		"2925533\tFrankfurt (Oder)\tFrankfurt (Oder)\t\t52.34714\t14.55062\tP\tPPLA3\tDE\t\t11\t\t\t\t58537\t\t\tEurope/Berlin\t2024-01-01\n" +
+		"4031637\tApia\tApia\t\t-13.83333\t-171.76666\tP\tPPLC\tWS\t\t11\t\t\t\t40407\t\t\tPacific/Apia\t2024-01-01\n" +
+		"broken line\n"
+	testCountries = "#ISO\tISO3\tISO-Numeric\tfips\tCountry\n" +
+		"DE\tDEU\t276\tGM\tGermany\n" +
+		"PL\tPOL\t616\tPL\tPoland\n" +
+		"WS\tWSM\t882\tWS\tSamoa\n"
+	testAdmin1 = "DE.16\tBerlin\tBerlin\t2950157\n" +
+		"DE.11\tBrandenburg\tBrandenburg\t2945356\n" +
+		"PL.76\tLubusz\tLubusz\t3337492\n"
+	// The Oder river is the border, Słubice is on the east bank (simplified)
+	testBoundaries = `{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {"ISO_A2": "PL", "NAME": "Poland"},
+		 "geometry": {"type": "Polygon", "coordinates": [[[14.56, 52.0], [16.0, 52.0], [16.0, 53.0], [14.56, 53.0], [14.56, 52.0]]]}},
+		{"type": "Feature", "properties": {"ISO_A2": "-99", "ISO_A2_EH": "DE", "NAME": "Germany"},
+		 "geometry": {"type": "MultiPolygon", "coordinates": [[[[12.0, 52.0], [14.56, 52.0], [14.56, 53.0], [12.0, 53.0], [12.0, 52.0]],
+		   [[13.0, 52.9], [13.1, 52.9], [13.1, 52.95], [13.0, 52.9]]]]}}
+	]}`
+)
+
+func testOffline(t *testing.T, boundaries bool) *Offline {
+	o := &Offline{grid: map[[2]int][]int32{}, countries: map[string]string{}, admin1: map[string]string{}}
+	if err := o.loadCities(strings.NewReader(testCities)); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.loadCountries(strings.NewReader(testCountries)); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.loadAdmin1(strings.NewReader(testAdmin1)); err != nil {
+		t.Fatal(err)
+	}
+	if boundaries {
+		if err := o.loadBoundaries(strings.NewReader(testBoundaries)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o
+}
+
+func TestOfflineLocate(t *testing.T) {
+	tests := []struct {
+		name       string
+		boundaries bool
+		lat, long  float64
+		display    string
+		city       string
+		area       string
+		country    string
+		code       string
+	}{
+		{"neighbourhood", false, 52.4987, 13.4030, "Kreuzberg, Berlin, Germany", "Berlin", "Kreuzberg", "Germany", "de"},
+		{"city only", false, 52.60, 13.30, "Berlin, Germany", "Berlin", "", "Germany", "de"},
+		{"nearest across the border", false, 52.3490, 14.5600, "Słubice, Lubusz, Poland", "Słubice", "", "Poland", "pl"},
+		{"boundary decides", true, 52.3490, 14.5590, "Frankfurt (Oder), Brandenburg, Germany", "Frankfurt (Oder)", "", "Germany", "de"},
+		{"across the date line", false, -13.8, 179.9, "", "", "", "", ""},
+		{"near the date line", false, -13.8, -171.8, "Apia, Samoa", "Apia", "", "Samoa", "ws"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := testOffline(t, tt.boundaries).Locate(tt.lat, tt.long)
+			if tt.display == "" {
+				if got != nil {
+					t.Errorf("Locate() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("Locate() = nil")
+			}
+			if got.DisplayName != tt.display || got.GetCity() != tt.city || got.Address.Neighbourhood != tt.area ||
+				got.Address.Country != tt.country || got.Address.CountryCode != tt.code {
+				t.Errorf("Locate() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestOfflineBoundaries(t *testing.T) {
+	o := testOffline(t, true)
+	if len(o.boundaries) != 2 {
+		t.Fatalf("boundaries = %d, want 2", len(o.boundaries))
+	}
+	if code, _ := o.countryAt(52.91, 13.05); code != "" {
+		t.Errorf("countryAt() in a hole = %s", code)
+	}
+	if code, name := o.countryAt(52.5, 13.4); code != "DE" || name != "Germany" {
+		t.Errorf("countryAt() = %s, %s", code, name)
+	}
+}
+
+func TestInitOffline(t *testing.T) {
+	dir := t.TempDir()
+	if err := InitOffline(dir, ""); err == nil {
+		t.Error("InitOffline() expected error without files")
+	}
+	files := map[string]string{"cities15000.txt": testCities, "countryInfo.txt": testCountries, "admin1CodesASCII.txt": testAdmin1}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := InitOffline(dir, ""); err != nil {
+		t.Fatalf("InitOffline() error = %v", err)
+	}
+	defer func() { offline = nil }()
+	if got := Reverse(52.52, 13.41); got == nil || got.City != "Berlin" || got.CountryCode != "de" {
+		t.Errorf("Reverse() = %+v", got)
+	}
+}
@@ -0,0 +1,92 @@
+package locations
+
+import (
+	"fmt"
+	"net/url"
+	"server/models"
+	"strings"
+)
+
+// Photon uses the Photon API (https://github.com/komoot/photon), either the public instance or a self-hosted one
+type Photon struct {
+	BaseURL  string // e.g. https://photon.komoot.io
+	Language string // Only a few languages are supported, optional
+}
+
+type PhotonProperties struct {
+	Type        string `json:"type"` // e.g. house, street, city
+	Name        string `json:"name"`
+	Street      string `json:"street"`
+	Locality    string `json:"locality"`
+	District    string `json:"district"`
+	City        string `json:"city"`
+	County      string `json:"county"`
+	State       string `json:"state"`
+	Country     string `json:"country"`
+	CountryCode string `json:"countrycode"`
+}
+
+type PhotonResult struct {
+	Features []struct {
+		Properties PhotonProperties `json:"properties"`
+	} `json:"features"`
+}
+
+func (p *Photon) Reverse(lat, long float64) (*models.Location, error) {
+	query := url.Values{}
+	query.Set("lat", fmt.Sprintf("%f", lat))
+	query.Set("lon", fmt.Sprintf("%f", long))
+	query.Set("limit", "1")
+	if p.Language != "" {
+		query.Set("lang", p.Language)
+	}
+	result := PhotonResult{}
+	if err := getJSON(strings.TrimRight(p.BaseURL, "/")+"/reverse?"+query.Encode(), nil, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Features) == 0 {
+		return nil, nil
+	}
+	return result.Features[0].Properties.toLocation(), nil
+}
+
+func (p *PhotonProperties) GetCity() string {
+	switch {
+	case p.City != "":
+		return p.City
+	case p.Type == "city":
+		return p.Name
+	case p.County != "":
+		return p.County
+	}
+	return p.State
+}
+
+func (p *PhotonProperties) GetArea() string {
+	city := p.GetCity()
+	for _, area := range []string{p.Locality, p.District, p.Name, p.Street} {
+		if area != "" && area != city {
+			return area
+		}
+	}
+	return city
+}
+
+// toLocation normalizes the result, the display name is built from the most to the least specific parts
+func (p *PhotonProperties) toLocation() *models.Location {
+	parts := []string{}
+	seen := map[string]bool{}
+	for _, part := range []string{p.Name, p.Street, p.Locality, p.District, p.GetCity(), p.State, p.Country} {
+		if part != "" && !seen[part] {
+			seen[part] = true
+			parts = append(parts, part)
+		}
+	}
+	return &models.Location{
+		Display:     strings.Join(parts, ", "),
+		Area:        p.GetArea(),
+		City:        p.GetCity(),
+		Country:     p.Country,
+		CountryCode: strings.ToLower(p.CountryCode),
+	}
+}
@@ -0,0 +1,17 @@
+package locations
+
+import "server/models"
+
+// Stub returns the same location for all coordinates, it's used in tests
+type Stub struct {
+	Location *models.Location
+	Err      error
+}
+
+func (s *Stub) Reverse(lat, long float64) (*models.Location, error) {
+	if s.Location == nil {
+		return nil, s.Err
+	}
+	location := *s.Location
+	return &location, s.Err
+}
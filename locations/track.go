@@ -0,0 +1,297 @@
+package locations
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrackPoint is a recorded position, Time is unix timestamp (UTC)
+type TrackPoint struct {
+	Time int64
+	Lat  float64
+	Long float64
+}
+
+// Track contains the points of a GPS track, sorted by time
+type Track []TrackPoint
+
+type gpxFile struct {
+	Tracks []struct {
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+	Waypoints []gpxPoint `xml:"wpt"`
+}
+
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Long float64 `xml:"lon,attr"`
+	Time string  `xml:"time"`
+}
+
+// kmlElement is used to walk all KML elements, as tracks can be nested in any number of folders
+type kmlElement struct {
+	XMLName  xml.Name
+	Children []kmlElement `xml:",any"`
+	Text     string       `xml:",chardata"`
+}
+
+type geoJSON struct {
+	Type       string          `json:"type"`
+	Features   []geoJSON       `json:"features"`
+	Geometry   *geoJSON        `json:"geometry"`
+	Geometries []geoJSON       `json:"geometries"`
+	Coords     json.RawMessage `json:"coordinates"`
+	Properties struct {
+		Time       string          `json:"time"`
+		Timestamp  string          `json:"timestamp"`
+		CoordTimes json.RawMessage `json:"coordTimes"` // Array of times for LineString, array of arrays for MultiLineString
+	} `json:"properties"`
+}
+
+// ParseTrack parses GPX, KML or GeoJSON data. Only points with time are included
+func ParseTrack(data []byte) (track Track, err error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		track, err = parseGeoJSON(trimmed)
+	case bytes.Contains(trimmed, []byte("<gpx")):
+		track, err = parseGPX(trimmed)
+	case bytes.Contains(trimmed, []byte("<kml")):
+		track, err = parseKML(trimmed)
+	default:
+		return nil, errors.New("unknown track format, GPX, KML or GeoJSON expected")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(track) == 0 {
+		return nil, errors.New("no points with time found in the track")
+	}
+	sort.SliceStable(track, func(i, j int) bool {
+		return track[i].Time < track[j].Time
+	})
+	return track, nil
+}
+
+func parseGPX(data []byte) (track Track, err error) {
+	gpx := gpxFile{}
+	if err = xml.Unmarshal(data, &gpx); err != nil {
+		return nil, err
+	}
+	add := func(p gpxPoint) {
+		if t, ok := parseTrackTime(p.Time); ok {
+			track = append(track, TrackPoint{Time: t, Lat: p.Lat, Long: p.Long})
+		}
+	}
+	for _, trk := range gpx.Tracks {
+		for _, seg := range trk.Segments {
+			for _, p := range seg.Points {
+				add(p)
+			}
+		}
+	}
+	for _, p := range gpx.Waypoints {
+		add(p)
+	}
+	return track, nil
+}
+
+// parseKML supports gx:Track (when + gx:coord pairs) and placemarks with a timestamp and a point
+func parseKML(data []byte) (track Track, err error) {
+	root := kmlElement{}
+	if err = xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	var walk func(e *kmlElement)
+	walk = func(e *kmlElement) {
+		switch e.XMLName.Local {
+		case "Track":
+			times, coords := []string{}, []string{}
+			for _, c := range e.Children {
+				switch c.XMLName.Local {
+				case "when":
+					times = append(times, c.Text)
+				case "coord":
+					coords = append(coords, c.Text)
+				}
+			}
+			for i := 0; i < len(times) && i < len(coords); i++ {
+				// Space separated: longitude latitude altitude
+				if p, ok := kmlPoint(times[i], strings.Fields(coords[i])); ok {
+					track = append(track, p)
+				}
+			}
+			return
+		case "Placemark":
+			when, coords := "", ""
+			var find func(e *kmlElement)
+			find = func(e *kmlElement) {
+				for i := range e.Children {
+					c := &e.Children[i]
+					switch c.XMLName.Local {
+					case "when":
+						when = c.Text
+					case "coordinates":
+						coords = c.Text
+					}
+					find(c)
+				}
+			}
+			find(e)
+			if when != "" {
+				// Comma separated: longitude,latitude,altitude
+				if p, ok := kmlPoint(when, strings.Split(strings.TrimSpace(coords), ",")); ok {
+					track = append(track, p)
+					return
+				}
+			}
+		}
+		for i := range e.Children {
+			walk(&e.Children[i])
+		}
+	}
+	walk(&root)
+	return track, nil
+}
+
+func kmlPoint(when string, coords []string) (TrackPoint, bool) {
+	t, ok := parseTrackTime(when)
+	if !ok || len(coords) < 2 {
+		return TrackPoint{}, false
+	}
+	long, err1 := strconv.ParseFloat(strings.TrimSpace(coords[0]), 64)
+	lat, err2 := strconv.ParseFloat(strings.TrimSpace(coords[1]), 64)
+	if err1 != nil || err2 != nil {
+		return TrackPoint{}, false
+	}
+	return TrackPoint{Time: t, Lat: lat, Long: long}, true
+}
+
+// parseGeoJSON supports LineStrings with "coordTimes" properties (as converted from GPX/KML by most tools) and Points with "time"
+func parseGeoJSON(data []byte) (track Track, err error) {
+	root := geoJSON{}
+	if err = json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	var walk func(g *geoJSON, times json.RawMessage, when string)
+	walk = func(g *geoJSON, times json.RawMessage, when string) {
+		switch g.Type {
+		case "FeatureCollection":
+			for i := range g.Features {
+				walk(&g.Features[i], nil, "")
+			}
+		case "Feature":
+			if g.Geometry != nil {
+				when = g.Properties.Time
+				if when == "" {
+					when = g.Properties.Timestamp
+				}
+				walk(g.Geometry, g.Properties.CoordTimes, when)
+			}
+		case "GeometryCollection":
+			for i := range g.Geometries {
+				walk(&g.Geometries[i], times, when)
+			}
+		case "Point":
+			point := []float64{}
+			if json.Unmarshal(g.Coords, &point) == nil && len(point) >= 2 {
+				if t, ok := parseTrackTime(when); ok {
+					track = append(track, TrackPoint{Time: t, Lat: point[1], Long: point[0]})
+				}
+			}
+		case "LineString":
+			line := [][]float64{}
+			lineTimes := []string{}
+			if json.Unmarshal(g.Coords, &line) == nil && json.Unmarshal(times, &lineTimes) == nil {
+				track = append(track, geoJSONLine(line, lineTimes)...)
+			}
+		case "MultiLineString":
+			lines := [][][]float64{}
+			linesTimes := [][]string{}
+			if json.Unmarshal(g.Coords, &lines) == nil && json.Unmarshal(times, &linesTimes) == nil {
+				for i := 0; i < len(lines) && i < len(linesTimes); i++ {
+					track = append(track, geoJSONLine(lines[i], linesTimes[i])...)
+				}
+			}
+		}
+	}
+	walk(&root, nil, "")
+	return track, nil
+}
+
+func geoJSONLine(line [][]float64, times []string) (track Track) {
+	for i := 0; i < len(line) && i < len(times); i++ {
+		if len(line[i]) < 2 {
+			continue
+		}
+		if t, ok := parseTrackTime(times[i]); ok {
+			track = append(track, TrackPoint{Time: t, Lat: line[i][1], Long: line[i][0]})
+		}
+	}
+	return
+}
+
+func parseTrackTime(s string) (int64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Unix(), true
+}
+
+// Start and End return the time of the first and last points
+func (t Track) Start() int64 {
+	return t[0].Time
+}
+
+func (t Track) End() int64 {
+	return t[len(t)-1].Time
+}
+
+// Locate returns the position at the given time. Between two points no more than maxGap seconds away, the position is interpolated,
+// otherwise the closest point is used if it's within maxGap seconds
+func (t Track) Locate(at, maxGap int64) (lat, long float64, ok bool) {
+	i := sort.Search(len(t), func(i int) bool {
+		return t[i].Time >= at
+	})
+	if i < len(t) && t[i].Time == at {
+		return t[i].Lat, t[i].Long, true
+	}
+	if i > 0 && i < len(t) {
+		prev, next := t[i-1], t[i]
+		if at-prev.Time <= maxGap && next.Time-at <= maxGap {
+			ratio := float64(at-prev.Time) / float64(next.Time-prev.Time)
+			return prev.Lat + (next.Lat-prev.Lat)*ratio, prev.Long + (next.Long-prev.Long)*ratio, true
+		}
+	}
+	// Closest point
+	best, bestDiff := -1, maxGap+1
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(t) {
+			continue
+		}
+		diff := t[j].Time - at
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff < bestDiff {
+			best, bestDiff = j, diff
+		}
+	}
+	if best < 0 {
+		return 0, 0, false
+	}
+	return t[best].Lat, t[best].Long, true
+}
@@ -0,0 +1,99 @@
+package locations
+
+import (
+	"math"
+	"testing"
+)
+
+const (
+	testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk><trkseg>
+    <trkpt lat="35.0" lon="139.0"><ele>10</ele><time>2024-05-01T10:00:10Z</time></trkpt>
+    <trkpt lat="35.1" lon="139.2"><time>2024-05-01T10:00:00Z</time></trkpt>
+    <trkpt lat="36.0" lon="140.0"></trkpt>
+  </trkseg></trk>
+</gpx>`
+	testKML = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">
+  <Document><Folder><Placemark>
+    <gx:Track>
+      <when>2024-05-01T10:00:00Z</when>
+      <when>2024-05-01T10:00:10Z</when>
+      <gx:coord>139.2 35.1 0</gx:coord>
+      <gx:coord>139.0 35.0 0</gx:coord>
+    </gx:Track>
+  </Placemark>
+  <Placemark>
+    <TimeStamp><when>2024-05-01T13:00:00+02:00</when></TimeStamp>
+    <Point><coordinates>13.4,52.5,0</coordinates></Point>
+  </Placemark></Folder></Document>
+</kml>`
+	testGeoJSON = `{"type":"FeatureCollection","features":[
+  {"type":"Feature","properties":{"coordTimes":["2024-05-01T10:00:00Z","2024-05-01T10:00:10Z"]},
+   "geometry":{"type":"LineString","coordinates":[[139.2,35.1],[139.0,35.0]]}},
+  {"type":"Feature","properties":{"coordTimes":[["2024-05-01T11:00:00Z"]]},
+   "geometry":{"type":"MultiLineString","coordinates":[[[1.5,2.5]]]}},
+  {"type":"Feature","properties":{"time":"2024-05-01T13:00:00+02:00"},
+   "geometry":{"type":"Point","coordinates":[13.4,52.5]}}
+]}`
+)
+
+func TestParseTrack(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Track
+	}{
+		{"GPX", testGPX, Track{{1714557600, 35.1, 139.2}, {1714557610, 35.0, 139.0}}},
+		{"KML", testKML, Track{{1714557600, 35.1, 139.2}, {1714557610, 35.0, 139.0}, {1714557600 + 3600, 52.5, 13.4}}},
+		{"GeoJSON", testGeoJSON, Track{{1714557600, 35.1, 139.2}, {1714557610, 35.0, 139.0}, {1714557600 + 3600, 2.5, 1.5}, {1714557600 + 3600, 52.5, 13.4}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseTrack([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: point %d is %v, want %v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+	if _, err := ParseTrack([]byte("lat,long\n1,2")); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if _, err := ParseTrack([]byte(`<gpx><trk><trkseg><trkpt lat="1" lon="2"/></trkseg></trk></gpx>`)); err == nil {
+		t.Error("expected error for track without times")
+	}
+}
+
+func TestTrackLocate(t *testing.T) {
+	track := Track{{1000, 10, 20}, {1100, 11, 22}, {2000, 20, 30}}
+	tests := []struct {
+		at        int64
+		ok        bool
+		lat, long float64
+	}{
+		{1000, true, 10, 20},   // Exact
+		{1050, true, 10.5, 21}, // Interpolated
+		{950, true, 10, 20},    // Before the start, within the gap
+		{899, false, 0, 0},     // Too early
+		{1200, true, 11, 22},   // Gap too big to interpolate, closest point
+		{1550, false, 0, 0},    // In the middle of a big gap
+		{1950, true, 20, 30},   // Closest point after the gap
+		{2100, true, 20, 30},   // After the end, within the gap
+		{2101, false, 0, 0},    // Too late
+	}
+	for _, tt := range tests {
+		lat, long, ok := track.Locate(tt.at, 100)
+		if ok != tt.ok || math.Abs(lat-tt.lat) > 1e-9 || math.Abs(long-tt.long) > 1e-9 {
+			t.Errorf("Locate(%d) = %f, %f, %v, want %f, %f, %v", tt.at, lat, long, ok, tt.lat, tt.long, tt.ok)
+		}
+	}
+}
@@ -7,8 +7,11 @@ package main
 import (
 	"log"
 	"server/auth"
+	"server/classifier"
 	"server/config"
 	"server/db"
+	"server/faces"
+	"server/locations"
 	"server/processing"
 	"server/utils"
 	"server/web"
@@ -38,6 +41,9 @@ func main() {
 	db.Init()
 	models.Init()
 	storage.Init()
+	classifier.Init()
+	faces.Init()
+	locations.Init()
 	processing.Init()
 	go processing.StartProcessing()
 
@@ -89,17 +95,51 @@ func main() {
 	authRouter.GET("/user/status", handlers.UserGetStatus)
 	authRouter.GET("/user/list", handlers.UserList)
 	authRouter.POST("/user/logout", handlers.UserLogout)
+	authRouter.POST("/user/video-profile", handlers.UserVideoProfileSave)
+	// Video transcoding profiles
+	authRouter.GET("/video-profile/list", handlers.VideoProfileList)
+	authRouter.POST("/video-profile/save", handlers.VideoProfileSave, models.PermissionAdmin)
+	authRouter.POST("/video-profile/delete", handlers.VideoProfileDelete, models.PermissionAdmin)
+	// External processing hooks
+	authRouter.GET("/processing-hook/list", handlers.ProcessingHookList, models.PermissionAdmin)
+	authRouter.POST("/processing-hook/save", handlers.ProcessingHookSave, models.PermissionAdmin)
+	authRouter.POST("/processing-hook/delete", handlers.ProcessingHookDelete, models.PermissionAdmin)
 	// Asset handlers
 	authRouter.GET("/asset/list", handlers.AssetList, models.PermissionPhotoUpload)
 	authRouter.GET("/asset/tags", handlers.TagList, models.PermissionPhotoUpload)
+	authRouter.GET("/asset/search-text", handlers.AssetSearchText)
 	authRouter.GET("/asset/fetch", handlers.AssetFetch)                                  // Auth checks are done inside the handler
+	authRouter.GET("/asset/detail", handlers.AssetGetDetail)                             // Auth checks are done inside the handler
 	authRouter.POST("/asset/delete", handlers.AssetDelete, models.PermissionPhotoUpload) // TODO: S3 Delete done?
 	authRouter.POST("/asset/favourite", handlers.AssetFavourite)
 	authRouter.POST("/asset/unfavourite", handlers.AssetUnfavourite)
+	authRouter.POST("/asset/caption", handlers.AssetCaption, models.PermissionPhotoUpload)
+	authRouter.POST("/asset/shift-time", handlers.AssetShiftTime, models.PermissionPhotoUpload)
+	authRouter.POST("/asset/location", handlers.AssetSetLocation, models.PermissionPhotoUpload)
+	authRouter.POST("/asset/geotag/preview", handlers.GeotagPreview, models.PermissionPhotoUpload)
+	authRouter.POST("/asset/geotag/apply", handlers.GeotagApply, models.PermissionPhotoUpload)
+	authRouter.GET("/asset/map", handlers.MapClusters, models.PermissionPhotoUpload)
+	authRouter.GET("/asset/edit", handlers.AssetEditGet, models.PermissionPhotoUpload)
+	authRouter.POST("/asset/edit", handlers.AssetEditSave, models.PermissionPhotoUpload)
+	authRouter.POST("/asset/edit/reset", handlers.AssetEditReset, models.PermissionPhotoUpload)
 	authRouter.GET("/faces/for-asset", handlers.FacesForAsset, models.PermissionPhotoUpload)
 	authRouter.GET("/faces/people", handlers.PeopleList, models.PermissionPhotoUpload)
 	authRouter.POST("/faces/create-person", handlers.CreatePerson, models.PermissionPhotoUpload)
 	authRouter.POST("/faces/assign", handlers.PersonAssignFace, models.PermissionPhotoUpload)
+	authRouter.POST("/faces/reject", handlers.FaceReject, models.PermissionPhotoUpload)
+	authRouter.POST("/faces/person/rename", handlers.PersonRename, models.PermissionPhotoUpload)
+	authRouter.POST("/faces/person/merge", handlers.PersonMerge, models.PermissionPhotoUpload)
+	authRouter.POST("/faces/person/hide", handlers.PersonHide, models.PermissionPhotoUpload)
+	authRouter.POST("/faces/person/delete", handlers.PersonDelete, models.PermissionPhotoUpload)
+	authRouter.POST("/faces/person/avatar", handlers.PersonSetAvatar, models.PermissionPhotoUpload)
+	authRouter.GET("/faces/person/shares", handlers.PersonSharesGet, models.PermissionPhotoUpload)
+	authRouter.POST("/faces/person/shares", handlers.PersonSharesSave, models.PermissionPhotoUpload)
+	authRouter.GET("/faces/person/assets", handlers.PersonAssets, models.PermissionPhotoUpload)
+	authRouter.GET("/faces/crop", handlers.FaceCrop, models.PermissionPhotoUpload)
+	authRouter.POST("/faces/reprocess", handlers.FaceReprocess, models.PermissionPhotoUpload)
+	authRouter.GET("/faces/clusters", handlers.FaceClusterList, models.PermissionPhotoUpload)
+	authRouter.POST("/faces/cluster/name", handlers.FaceClusterName, models.PermissionPhotoUpload)
+	authRouter.POST("/faces/cluster/dismiss", handlers.FaceClusterDismiss, models.PermissionPhotoUpload)
 	// Album handlers
 	authRouter.GET("/album/list", handlers.AlbumList)
 	authRouter.POST("/album/create", handlers.AlbumCreate, models.PermissionPhotoUpload)
@@ -108,6 +148,7 @@ func main() {
 	authRouter.POST("/album/add", handlers.AlbumAddAssets, models.PermissionPhotoUpload)
 	authRouter.POST("/album/remove", handlers.AlbumRemoveAsset, models.PermissionPhotoUpload)
 	authRouter.GET("/album/assets", handlers.AlbumAssets)
+	authRouter.GET("/album/map", handlers.AlbumMapClusters)
 	authRouter.GET("/album/share", handlers.AlbumShare)
 	authRouter.POST("/album/contributor", handlers.AlbumContributorSave, models.PermissionPhotoUpload) // DEPRECATED
 	authRouter.GET("/album/contributors", handlers.AlbumContributorsGet, models.PermissionPhotoUpload)
@@ -137,6 +178,8 @@ func main() {
 	// Web albums
 	router.GET("/w/album/:token/", web.AlbumView)
 	router.GET("/w/album/:token/asset", web.AlbumAssetView)
+	router.GET("/w/album/:token/face", web.AlbumFaceView)
+	router.GET("/w/album/:token/map", web.AlbumMapView)
 	// Web file uploads
 	router.GET("/w/upload/:token/", web.UploadRequestView)
 	router.GET("/w/upload/:token/new-url/", web.UploadRequestNewURL)
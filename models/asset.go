@@ -2,10 +2,12 @@ package models
 
 import (
 	"fmt"
+	"image"
 	"path/filepath"
 	"server/config"
 	"server/db"
 	"server/storage"
+	"server/utils"
 	"strconv"
 	"strings"
 	"time"
@@ -21,6 +23,14 @@ const (
 
 	presignViewURLFor      = time.Hour * 24 * 7
 	presignValidAtLeastFor = time.Minute * 30
+
+	blurHashXComponents = 4
+	blurHashYComponents = 3
+
+	// Where the time or location of an asset come from. Values set by the user are not overwritten by processing
+	MetadataSourceFile  = "" // The file's metadata or the client
+	MetadataSourceUser  = "user"
+	MetadataSourceTrack = "track" // Location from an imported GPS track
 )
 
 type Asset struct {
@@ -52,10 +62,21 @@ type Asset struct {
 	Duration            uint32
 	Path                string `gorm:"type:varchar(2048)"` // Full path of the asset, including file/object name
 	ThumbPath           string `gorm:"type:varchar(2048)"` // Same but for thumbnail
+	OriginalPath        string `gorm:"type:varchar(2048)"` // Original video file, if kept after conversion
+	PreviewPath         string `gorm:"type:varchar(2048)"` // JPEG preview extracted from RAW files, used in place of the original for display
 	PresignedUntil      int64
 	PresignedURL        string `gorm:"type:varchar(2000)"`
 	PresignedThumbUntil int64
-	PresignedThumbURL   string `gorm:"type:varchar(2000)"`
+	PresignedThumbURL   string  `gorm:"type:varchar(2000)"`
+	BlurHash            string  `gorm:"type:varchar(40)"`   // Placeholder to show before the thumbnail is loaded
+	DominantColor       string  `gorm:"type:varchar(7)"`    // e.g. #a0b1c2
+	VideoProfileID      *uint64 `gorm:"default:null"`       // Video profile used for the conversion (nil for the default one)
+	VideoProfileVersion uint    `gorm:"default:0"`          // Version of the profile used for the conversion
+	PairedWithID        *uint64 `gorm:"default:null;index"` // For RAW files, the JPEG taken together with it. Paired RAW files are hidden from listings
+	Caption             string  `gorm:"type:varchar(2000)"`
+	WritebackPending    bool    `gorm:"default:false"`    // Metadata was changed and needs to be written back to the file (if enabled)
+	TimeSource          string  `gorm:"type:varchar(10)"` // See MetadataSource* constants
+	GpsSource           string  `gorm:"type:varchar(10)"`
 }
 
 // CreatePath returns new path for an asset. For example:
@@ -146,10 +167,25 @@ func (a *Asset) BeforeSave(tx *gorm.DB) (err error) {
 	return
 }
 
+// SetPlaceholders calculates the BlurHash and dominant colour from the given thumbnail image
+func (a *Asset) SetPlaceholders(thumb image.Image) {
+	a.BlurHash = utils.BlurHash(thumb, blurHashXComponents, blurHashYComponents)
+	a.DominantColor = utils.DominantColor(thumb)
+}
+
 func (a *Asset) IsVideo() bool {
 	return strings.HasPrefix(strings.ToLower(a.MimeType), "video/")
 }
 
+// SidecarPath returns the path of the XMP sidecar file, used for metadata write-back
+func (a *Asset) SidecarPath() string {
+	return a.Path + ".xmp"
+}
+
+func (a *Asset) IsImage() bool {
+	return strings.HasPrefix(strings.ToLower(a.MimeType), "image/")
+}
+
 func (a *Asset) GetRoughLocation() (location Location) {
 	if a.GpsLat != nil && a.GpsLong != nil {
 		// Truncate - only use 0.0001 of precision
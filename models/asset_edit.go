@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"image"
+	"path/filepath"
+	"server/storage"
+	"server/utils"
+	"strings"
+	"time"
+)
+
+// AssetEdit contains non-destructive edits for an image, the original is never modified.
+// Edits are applied in order: rotation, crop, brightness/contrast
+type AssetEdit struct {
+	AssetID     uint64  `gorm:"primaryKey" json:"id"`
+	Asset       Asset   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UpdatedAt   int64   `json:"updated_at"`
+	Rotation    int     `gorm:"not null" json:"rotation"` // Clockwise, one of 0, 90, 180, 270
+	CropX       float64 `gorm:"not null" json:"crop_x"`   // Crop rectangle relative to the rotated image (0 to 1)
+	CropY       float64 `gorm:"not null" json:"crop_y"`
+	CropWidth   float64 `gorm:"not null" json:"crop_width"` // No cropping if width or height is 0
+	CropHeight  float64 `gorm:"not null" json:"crop_height"`
+	Brightness  float64 `gorm:"not null" json:"brightness"`  // -1 to 1
+	Contrast    float64 `gorm:"not null" json:"contrast"`    // -1 to 1
+	ThumbPath   string  `gorm:"type:varchar(2048)" json:"-"` // Rendered thumbnail
+	ThumbSize   int64   `json:"-"`
+	DisplayPath string  `gorm:"type:varchar(2048)" json:"-"` // Rendered display variant (in place of the original)
+	DisplaySize int64   `json:"-"`
+}
+
+func (e *AssetEdit) Validate() error {
+	e.Rotation = (e.Rotation%360 + 360) % 360
+	if e.Rotation%90 != 0 {
+		return errors.New("rotation must be a multiple of 90 degrees")
+	}
+	if e.CropX < 0 || e.CropY < 0 || e.CropWidth < 0 || e.CropHeight < 0 || e.CropX+e.CropWidth > 1 || e.CropY+e.CropHeight > 1 {
+		return errors.New("crop rectangle must be within the image")
+	}
+	if e.Brightness < -1 || e.Brightness > 1 || e.Contrast < -1 || e.Contrast > 1 {
+		return errors.New("brightness and contrast must be between -1 and 1")
+	}
+	return nil
+}
+
+// Apply renders the edits on the given (upright) image
+func (e *AssetEdit) Apply(img image.Image) image.Image {
+	img = utils.RotateImage(img, e.Rotation)
+	if e.CropWidth > 0 && e.CropHeight > 0 {
+		img = utils.CropImage(img, e.CropX, e.CropY, e.CropWidth, e.CropHeight)
+	}
+	return utils.AdjustImage(img, e.Brightness, e.Contrast)
+}
+
+// SetPaths sets the paths of the rendered variants, next to the asset's files
+func (e *AssetEdit) SetPaths(a *Asset) {
+	e.ThumbPath = strings.TrimSuffix(a.GetPathOrThumb(true), ".jpg") + "_edited.jpg"
+	path := a.GetPathOrThumb(false)
+	e.DisplayPath = strings.TrimSuffix(path, filepath.Ext(path)) + "_edited.jpg"
+}
+
+// IsRendered returns true if the edited variants are available
+func (e *AssetEdit) IsRendered() bool {
+	return e.ThumbSize > 0 && e.DisplaySize > 0
+}
+
+// GetS3DownloadURL presigns the rendered thumb or display variant, see Asset.GetS3DownloadURL
+func (e *AssetEdit) GetS3DownloadURL(bucket *storage.Bucket, thumb bool) (string, int64) {
+	path := e.DisplayPath
+	if thumb {
+		path = e.ThumbPath
+	}
+	return bucket.CreateS3DownloadURI(path, presignViewURLFor), time.Now().Add(presignViewURLFor).Unix()
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// AssetExif contains camera and exposure information extracted from the asset's EXIF data
+type AssetExif struct {
+	AssetID      uint64  `gorm:"primaryKey"`
+	Asset        Asset   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Make         string  `gorm:"type:varchar(100)"`
+	Model        string  `gorm:"type:varchar(100)"`
+	LensModel    string  `gorm:"type:varchar(150)"`
+	FocalLength  float64 `gorm:"type:double"` // in mm
+	ISO          int     `gorm:"type:int"`
+	FNumber      float64 `gorm:"type:double"` // Aperture, e.g. 1.8
+	ExposureTime float64 `gorm:"type:double"` // Shutter speed in seconds
+}
+
+// GetCamera returns the camera body, e.g. "Canon EOS R5" (the make is often repeated in the model)
+func (e *AssetExif) GetCamera() string {
+	if e.Model == "" || strings.HasPrefix(strings.ToLower(e.Model), strings.ToLower(e.Make)) {
+		return e.Model
+	}
+	return e.Make + " " + e.Model
+}
+
+// GetFocalLength returns e.g. "50mm"
+func (e *AssetExif) GetFocalLength() string {
+	if e.FocalLength <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(e.FocalLength, 'f', -1, 64) + "mm"
+}
+
+// GetISO returns e.g. "ISO 400"
+func (e *AssetExif) GetISO() string {
+	if e.ISO <= 0 {
+		return ""
+	}
+	return "ISO " + strconv.Itoa(e.ISO)
+}
+
+// GetAperture returns e.g. "f/1.8"
+func (e *AssetExif) GetAperture() string {
+	if e.FNumber <= 0 {
+		return ""
+	}
+	return "f/" + strconv.FormatFloat(e.FNumber, 'f', -1, 64)
+}
+
+// GetShutterSpeed returns e.g. "1/250" or "2s" for longer exposures
+func (e *AssetExif) GetShutterSpeed() string {
+	if e.ExposureTime <= 0 {
+		return ""
+	}
+	if e.ExposureTime >= 0.5 {
+		return strconv.FormatFloat(e.ExposureTime, 'f', -1, 64) + "s"
+	}
+	return "1/" + strconv.Itoa(int(math.Round(1/e.ExposureTime)))
+}
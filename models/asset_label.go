@@ -0,0 +1,10 @@
+package models
+
+// AssetLabel is a semantic label (e.g. "beach", "dog") detected by the image classifier
+type AssetLabel struct {
+	ID         uint64  `gorm:"primaryKey"`
+	AssetID    uint64  `gorm:"index:uniq_asset_label,unique"`
+	Asset      Asset   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Name       string  `gorm:"type:varchar(100);index:uniq_asset_label,unique"`
+	Confidence float64 `gorm:"type:double"` // 0 to 1
+}
@@ -0,0 +1,12 @@
+package models
+
+// AssetQuality keeps the image quality scores of an asset, used to pick the "best shots"
+type AssetQuality struct {
+	AssetID   uint64  `gorm:"primaryKey"`
+	Asset     Asset   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Sharpness float64 `gorm:"type:double"` // Normalized variance of the Laplacian, 0 to 1
+	Exposure  float64 `gorm:"type:double"` // 0 to 1, lower for under/over exposed images
+	Faces     int     `gorm:"type:int"`    // Number of detected faces
+	FaceScore float64 `gorm:"type:double"` // Sharpness around the eyes of the detected faces, 0 to 1
+	Score     float64 `gorm:"type:double;index"`
+}
@@ -0,0 +1,31 @@
+package models
+
+const (
+	AssetTagSourceClassify = "classify" // Tags added by the built-in classification task
+
+	// Asset classes (AssetTag names with the classify source)
+	AssetClassScreenshot = "screenshot"
+	AssetClassPanorama   = "panorama"
+	AssetClass360        = "360"
+	AssetClassPortrait   = "portrait"
+	AssetClassDocument   = "document"
+)
+
+// AssetTag is a free-form tag attached to an asset by a processing task or an external hook
+type AssetTag struct {
+	ID      uint64 `gorm:"primaryKey"`
+	AssetID uint64 `gorm:"index:uniq_asset_tag,unique"`
+	Asset   Asset  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Source  string `gorm:"type:varchar(100);index:uniq_asset_tag,unique;index"` // The task that created it, e.g. "hook_1"
+	Name    string `gorm:"type:varchar(100);index:uniq_asset_tag,unique"`
+}
+
+// AssetMetadata is a free-form name/value pair attached to an asset by an external hook
+type AssetMetadata struct {
+	ID      uint64 `gorm:"primaryKey"`
+	AssetID uint64 `gorm:"index:uniq_asset_metadata,unique"`
+	Asset   Asset  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Source  string `gorm:"type:varchar(100);index:uniq_asset_metadata,unique;index"`
+	Name    string `gorm:"type:varchar(100);index:uniq_asset_metadata,unique"`
+	Value   string `gorm:"type:varchar(1024)"`
+}
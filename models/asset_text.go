@@ -0,0 +1,8 @@
+package models
+
+// AssetText contains the text recognized in an asset (OCR)
+type AssetText struct {
+	AssetID uint64 `gorm:"primaryKey"`
+	Asset   Asset  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Text    string `gorm:"type:text"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// FaceCluster is a suggested group of similar faces, not assigned to any person yet
+type FaceCluster struct {
+	ID        uint64 `gorm:"primaryKey"`
+	CreatedAt int64  `gorm:""`
+	UserID    uint64 `gorm:"index"`
+	User      User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Size      int    `gorm:"type:int"`      // Number of faces when clustered, some may be assigned since
+	Dismissed bool   `gorm:"default:false"` // Faces of dismissed clusters are not suggested again
+}
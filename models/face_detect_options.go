@@ -0,0 +1,10 @@
+package models
+
+// FaceDetectOptions overrides the face detection settings for an asset, set when faces are reprocessed
+type FaceDetectOptions struct {
+	AssetID  uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Asset    Asset  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CNN      bool   `gorm:"not null;default:false"`
+	Upsample int    `gorm:"not null;default:0"`
+	MinSize  int    `gorm:"not null;default:0"`
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"log"
+	"server/db"
+	"server/utils"
+	"sort"
+	"sync"
+)
+
+const (
+	faceIndexLoadBatchSize = 5000
+)
+
+// FaceMatch is a face found by FaceIndex.Search
+type FaceMatch struct {
+	FaceID     uint64
+	AssetID    uint64
+	DistanceSq float64
+}
+
+// userFaces keeps the descriptors of a user's faces next to each other, so they can be scanned quickly
+type userFaces struct {
+	ids       []uint64
+	assetIDs  []uint64
+	vectors   []float32 // FaceDescriptorSize values for each face
+	positions map[uint64]int
+}
+
+// faceIndex is an in-memory (brute-force) index of all face descriptors, per user
+type faceIndex struct {
+	sync.RWMutex
+	users map[uint64]*userFaces
+}
+
+var (
+	FaceIndex = &faceIndex{users: map[uint64]*userFaces{}}
+)
+
+// LoadFaceIndex loads all face descriptors from the DB
+func LoadFaceIndex() error {
+	FaceIndex.Lock()
+	FaceIndex.users = map[uint64]*userFaces{}
+	FaceIndex.Unlock()
+	lastID := uint64(0)
+	count := 0
+	for {
+		batch := []Face{}
+		err := db.Instance.Select("id", "user_id", "asset_id", "encoding").
+			Where("id > ? and encoding is not null", lastID).Order("id").Limit(faceIndexLoadBatchSize).Find(&batch).Error
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for i := range batch {
+			FaceIndex.Add(&batch[i])
+		}
+		lastID = batch[len(batch)-1].ID
+		count += len(batch)
+	}
+	log.Printf("Face index loaded: %d faces", count)
+	return nil
+}
+
+// Add adds (or replaces) a face in the index
+func (ix *faceIndex) Add(face *Face) {
+	descriptor := face.Descriptor()
+	if len(descriptor) != FaceDescriptorSize {
+		return
+	}
+	ix.Lock()
+	defer ix.Unlock()
+	u := ix.users[face.UserID]
+	if u == nil {
+		u = &userFaces{positions: map[uint64]int{}}
+		ix.users[face.UserID] = u
+	}
+	if pos, ok := u.positions[face.ID]; ok {
+		u.assetIDs[pos] = face.AssetID
+		copy(u.vectors[pos*FaceDescriptorSize:], descriptor)
+		return
+	}
+	u.positions[face.ID] = len(u.ids)
+	u.ids = append(u.ids, face.ID)
+	u.assetIDs = append(u.assetIDs, face.AssetID)
+	u.vectors = append(u.vectors, descriptor...)
+}
+
+// RemoveAsset removes the faces of the given asset
+func (ix *faceIndex) RemoveAsset(userID, assetID uint64) {
+	ix.Lock()
+	defer ix.Unlock()
+	u := ix.users[userID]
+	if u == nil {
+		return
+	}
+	for pos := len(u.ids) - 1; pos >= 0; pos-- {
+		if u.assetIDs[pos] != assetID {
+			continue
+		}
+		// Move the last face in place of the removed one
+		last := len(u.ids) - 1
+		delete(u.positions, u.ids[pos])
+		if pos != last {
+			u.ids[pos] = u.ids[last]
+			u.assetIDs[pos] = u.assetIDs[last]
+			copy(u.vectors[pos*FaceDescriptorSize:(pos+1)*FaceDescriptorSize], u.vectors[last*FaceDescriptorSize:])
+			u.positions[u.ids[pos]] = pos
+		}
+		u.ids = u.ids[:last]
+		u.assetIDs = u.assetIDs[:last]
+		u.vectors = u.vectors[:last*FaceDescriptorSize]
+	}
+}
+
+// Get returns the descriptor of a face, or nil if not in the index
+func (ix *faceIndex) Get(userID, faceID uint64) []float32 {
+	ix.RLock()
+	defer ix.RUnlock()
+	u := ix.users[userID]
+	if u == nil {
+		return nil
+	}
+	pos, ok := u.positions[faceID]
+	if !ok {
+		return nil
+	}
+	return append([]float32{}, u.vectors[pos*FaceDescriptorSize:(pos+1)*FaceDescriptorSize]...)
+}
+
+// Search returns the user's faces within maxDistanceSq of the descriptor, closest first
+func (ix *faceIndex) Search(userID uint64, descriptor []float32, maxDistanceSq float64) []FaceMatch {
+	result := []FaceMatch{}
+	if len(descriptor) != FaceDescriptorSize {
+		return result
+	}
+	ix.RLock()
+	u := ix.users[userID]
+	if u != nil {
+		for pos, id := range u.ids {
+			d := utils.DistanceSq(descriptor, u.vectors[pos*FaceDescriptorSize:(pos+1)*FaceDescriptorSize])
+			if d <= maxDistanceSq {
+				result = append(result, FaceMatch{FaceID: id, AssetID: u.assetIDs[pos], DistanceSq: d})
+			}
+		}
+	}
+	ix.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DistanceSq < result[j].DistanceSq
+	})
+	return result
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+)
+
+func testFace(id, userID, assetID uint64, value float32) *Face {
+	descriptor := make([]float32, FaceDescriptorSize)
+	for i := range descriptor {
+		descriptor[i] = value
+	}
+	face := &Face{ID: id, UserID: userID, AssetID: assetID}
+	face.SetDescriptor(descriptor)
+	return face
+}
+
+func TestFaceIndex(t *testing.T) {
+	ix := &faceIndex{users: map[uint64]*userFaces{}}
+	ix.Add(testFace(1, 1, 10, 0))
+	ix.Add(testFace(2, 1, 11, 0.01))
+	ix.Add(testFace(3, 1, 11, 0.5))
+	ix.Add(testFace(4, 2, 12, 0))                // Another user
+	ix.Add(&Face{ID: 5, UserID: 1, AssetID: 13}) // No descriptor
+
+	query := testFace(0, 1, 0, 0.005).Descriptor()
+	matches := ix.Search(1, query, 0.11)
+	if len(matches) != 2 || matches[0].FaceID != 1 || matches[1].FaceID != 2 || matches[1].AssetID != 11 {
+		t.Fatalf("Search() = %+v, want faces 1 and 2", matches)
+	}
+	if d := matches[0].DistanceSq; d < 0.0031 || d > 0.0033 {
+		t.Errorf("DistanceSq = %f, want 128*0.005^2", d)
+	}
+	if got := ix.Get(1, 3); len(got) != FaceDescriptorSize || got[0] != 0.5 {
+		t.Errorf("Get(3) = %v", got)
+	}
+	if got := ix.Get(1, 5); got != nil {
+		t.Errorf("Get(5) = %v, want nil", got)
+	}
+
+	// Faces 2 and 3 are removed, face 1 must still be found
+	ix.RemoveAsset(1, 11)
+	matches = ix.Search(1, query, 10)
+	if len(matches) != 1 || matches[0].FaceID != 1 {
+		t.Errorf("Search() after RemoveAsset = %+v, want face 1 only", matches)
+	}
+	if ix.Get(1, 2) != nil || ix.Get(1, 3) != nil {
+		t.Error("removed faces are still in the index")
+	}
+	if matches = ix.Search(2, query, 0.11); len(matches) != 1 || matches[0].FaceID != 4 {
+		t.Errorf("Search() for user 2 = %+v, want face 4", matches)
+	}
+}
@@ -0,0 +1,15 @@
+package models
+
+// FaceRejection records that a face is NOT the given person ("not this person"), so it's not assigned to them automatically
+type FaceRejection struct {
+	FaceID    uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Face      Face   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	PersonID  uint64 `gorm:"primaryKey;autoIncrement:false;index"`
+	Person    Person `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt int64
+}
+
+const (
+	// Faces (aliased as "faces") that were not rejected for the given person ID
+	NotRejectedFaceClause = "not exists (select 1 from face_rejections where face_rejections.face_id = faces.id and face_rejections.person_id = ?)"
+)
@@ -18,7 +18,16 @@ func Init() {
 	es = append(es, db.Instance.AutoMigrate(&AlbumAsset{}))
 	es = append(es, db.Instance.AutoMigrate(&AlbumShare{}))
 	es = append(es, db.Instance.AutoMigrate(&Asset{}))
+	es = append(es, db.Instance.AutoMigrate(&AssetEdit{}))
+	es = append(es, db.Instance.AutoMigrate(&AssetExif{}))
+	es = append(es, db.Instance.AutoMigrate(&AssetLabel{}))
+	es = append(es, db.Instance.AutoMigrate(&AssetMetadata{}))
+	es = append(es, db.Instance.AutoMigrate(&AssetQuality{}))
+	es = append(es, db.Instance.AutoMigrate(&AssetTag{}))
+	es = append(es, db.Instance.AutoMigrate(&AssetText{}))
+	es = append(es, db.Instance.AutoMigrate(&FaceCluster{}))
 	es = append(es, db.Instance.AutoMigrate(&Face{}))
+	es = append(es, db.Instance.AutoMigrate(&FaceDetectOptions{}))
 	es = append(es, db.Instance.AutoMigrate(&FavouriteAsset{}))
 	es = append(es, db.Instance.AutoMigrate(&Grant{}))
 	es = append(es, db.Instance.AutoMigrate(&Group{}))
@@ -26,8 +35,12 @@ func Init() {
 	es = append(es, db.Instance.AutoMigrate(&GroupUser{}))
 	es = append(es, db.Instance.AutoMigrate(&Location{}))
 	es = append(es, db.Instance.AutoMigrate(&Place{}))
+	es = append(es, db.Instance.AutoMigrate(&ProcessingHook{}))
 	es = append(es, db.Instance.AutoMigrate(&Person{}))
+	es = append(es, db.Instance.AutoMigrate(&FaceRejection{}))
+	es = append(es, db.Instance.AutoMigrate(&PersonShare{}))
 	es = append(es, db.Instance.AutoMigrate(&UploadRequest{}))
+	es = append(es, db.Instance.AutoMigrate(&VideoProfile{}))
 	es = append(es, db.Instance.AutoMigrate(&User{}))
 	es = append(es, db.Instance.AutoMigrate(&VideoCall{}))
 
@@ -36,4 +49,8 @@ func Init() {
 			log.Printf("Auto-migrate error: %v", e)
 		}
 	}
+	migrateFaceDescriptors()
+	if err := LoadFaceIndex(); err != nil {
+		log.Printf("Face index error: %v", err)
+	}
 }
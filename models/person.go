@@ -1,11 +1,13 @@
 package models
 
 type Person struct {
-	ID        uint64 `gorm:"primaryKey"`
-	CreatedAt int64  `gorm:""`
-	UserID    uint64 `gorm:"index:uniq_user_person,unique;priority:1"`
-	User      User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	Name      string `gorm:"type:varchar(300);index:uniq_user_person,unique;priority:2"`
+	ID           uint64  `gorm:"primaryKey"`
+	CreatedAt    int64   `gorm:""`
+	UserID       uint64  `gorm:"index:uniq_user_person,unique;priority:1"`
+	User         User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Name         string  `gorm:"type:varchar(300);index:uniq_user_person,unique;priority:2"`
+	Hidden       bool    `gorm:"not null;default:false"` // e.g. strangers, not listed by default
+	AvatarFaceID *uint64 `gorm:""`                       // Preferred face to show, the latest one if not set
 }
 
 // TableName overrides the table name
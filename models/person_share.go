@@ -0,0 +1,35 @@
+package models
+
+import "server/db"
+
+// PersonShare makes a person available to another user or to all members of a group,
+// so they can assign their own faces to the same person. Assets stay private to their owners
+type PersonShare struct {
+	ID        uint64 `gorm:"primaryKey"`
+	CreatedAt int64
+	PersonID  uint64  `gorm:"index"`
+	Person    Person  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID    *uint64 `gorm:"index"`
+	User      User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	GroupID   *uint64 `gorm:"index"`
+	Group     Group   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+const (
+	// Own people or ones shared with the user directly or via a group (user ID is needed 3 times)
+	AccessiblePeopleClause = "(people.user_id = ? OR exists (select 1 from person_shares where person_shares.person_id = people.id and " +
+		"(person_shares.user_id = ? OR person_shares.group_id in (select group_users.group_id from group_users where group_users.user_id = ?))))"
+)
+
+// PeopleSharedWith returns the people of other users, shared with the given user
+func PeopleSharedWith(userID uint64) (people []Person, err error) {
+	err = db.Instance.Where("people.user_id != ? and "+AccessiblePeopleClause, userID, userID, userID, userID).Find(&people).Error
+	return
+}
+
+// CanAccessPerson returns true if the person is the user's own or shared with them
+func CanAccessPerson(userID, personID uint64) bool {
+	var count int64
+	db.Instance.Model(&Person{}).Where("people.id = ? and "+AccessiblePeopleClause, personID, userID, userID, userID).Count(&count)
+	return count > 0
+}
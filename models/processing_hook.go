@@ -0,0 +1,48 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	ProcessingHookCommand = "command"
+	ProcessingHookWebhook = "webhook"
+
+	DefaultProcessingHookTimeout = 60 // in seconds
+)
+
+// ProcessingHook is an external command or webhook that admins register to run on each asset,
+// just like the built-in processing tasks
+type ProcessingHook struct {
+	ID              uint64 `gorm:"primaryKey" json:"id"`
+	CreatedAt       int64  `json:"-"`
+	UpdatedAt       int64  `json:"-"`
+	Name            string `gorm:"type:varchar(100);index:uniq_processing_hook_name,unique" json:"name"`
+	Type            string `gorm:"type:varchar(10)" json:"type"`        // One of command, webhook
+	Target          string `gorm:"type:varchar(2048)" json:"target"`    // Command path or webhook URL
+	MimeTypes       string `gorm:"type:varchar(500)" json:"mime_types"` // Comma-separated prefixes, e.g. "image/,video/mp4" (empty for all)
+	Timeout         uint16 `gorm:"not null" json:"timeout"`             // in seconds
+	RequiresContent bool   `gorm:"not null" json:"requires_content"`
+	Enabled         bool   `gorm:"not null" json:"enabled"`
+}
+
+// TaskName is used to track the hook status alongside the built-in tasks.
+// It depends on the ID only, so renaming a hook doesn't re-run it
+func (h *ProcessingHook) TaskName() string {
+	return "hook_" + strconv.FormatUint(h.ID, 10)
+}
+
+func (h *ProcessingHook) MatchesMimeType(mimeType string) bool {
+	if strings.TrimSpace(h.MimeTypes) == "" {
+		return true
+	}
+	mimeType = strings.ToLower(mimeType)
+	for _, prefix := range strings.Split(h.MimeTypes, ",") {
+		prefix = strings.ToLower(strings.TrimSpace(prefix))
+		if prefix != "" && strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+	return false
+}
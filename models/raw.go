@@ -0,0 +1,51 @@
+package models
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// RAW file extensions and their mime types (not known to the mime package)
+	rawMimeTypes = map[string]string{
+		".dng": "image/x-adobe-dng",
+		".cr2": "image/x-canon-cr2",
+		".cr3": "image/x-canon-cr3",
+		".nef": "image/x-nikon-nef",
+		".arw": "image/x-sony-arw",
+		".orf": "image/x-olympus-orf",
+		".rw2": "image/x-panasonic-rw2",
+		".raf": "image/x-fuji-raf",
+		".pef": "image/x-pentax-pef",
+	}
+)
+
+// RawMimeTypeByExtension returns the mime type for RAW file names, or empty string for anything else
+func RawMimeTypeByExtension(name string) string {
+	return rawMimeTypes[strings.ToLower(filepath.Ext(name))]
+}
+
+func IsRawMimeType(mimeType string) bool {
+	mimeType = strings.ToLower(mimeType)
+	for _, m := range rawMimeTypes {
+		if m == mimeType {
+			return true
+		}
+	}
+	return mimeType == "image/dng" // Sometimes used for DNG as well
+}
+
+func (a *Asset) IsRaw() bool {
+	return IsRawMimeType(a.MimeType)
+}
+
+// CreatePreviewPath returns the path of the JPEG preview extracted from a RAW file
+func (a *Asset) CreatePreviewPath() string {
+	return strings.TrimSuffix(a.Path, filepath.Ext(a.Path)) + "_preview.jpg"
+}
+
+// GetS3PreviewURL returns a presigned URL for the RAW preview (not cached, unlike the original)
+func (a *Asset) GetS3PreviewURL() (string, int64) {
+	return a.Bucket.CreateS3DownloadURI(a.PreviewPath, presignViewURLFor), time.Now().Add(presignViewURLFor).Unix()
+}
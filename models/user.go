@@ -24,8 +24,10 @@ type User struct {
 	PushToken   string         `gorm:"type:varchar(128)"`
 
 	// Settings
-	Quota        int64 `gorm:"not null"` // in MB
-	VideoSetting uint8 `gorm:"not null"`
+	Quota          int64 `gorm:"not null"` // in MB
+	VideoSetting   uint8 `gorm:"not null"`
+	VideoProfileID *uint64
+	VideoProfile   *VideoProfile `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 	// ImageProcessing uint8 `gorm:"not null"` // 0 - no, 1 - always to JPEG
 }
 
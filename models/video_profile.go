@@ -0,0 +1,48 @@
+package models
+
+const (
+	VideoCodecH264 = "h264"
+	VideoCodecHEVC = "hevc"
+	VideoCodecAV1  = "av1"
+)
+
+var (
+	// DefaultVideoProfile is used for users that haven't picked a profile
+	DefaultVideoProfile = VideoProfile{
+		Name:         "Default",
+		Codec:        VideoCodecH264,
+		CRF:          24,
+		AudioBitrate: 128,
+	}
+)
+
+// VideoProfile contains transcoding settings defined by admins and picked by users
+type VideoProfile struct {
+	ID            uint64 `gorm:"primaryKey" json:"id"`
+	CreatedAt     int64  `json:"-"`
+	UpdatedAt     int64  `json:"-"`
+	Name          string `gorm:"type:varchar(100);index:uniq_video_profile_name,unique" json:"name"`
+	MaxResolution uint16 `gorm:"not null" json:"max_resolution"` // Maximum size of the shorter side, e.g. 1080 (0 keeps the original resolution)
+	Codec         string `gorm:"type:varchar(10)" json:"codec"`  // One of h264, hevc, av1
+	CRF           uint8  `gorm:"not null" json:"crf"`
+	AudioBitrate  uint16 `gorm:"not null" json:"audio_bitrate"` // in kbps
+	KeepOriginal  bool   `gorm:"not null" json:"keep_original"` // Keep the original file alongside the converted one
+	Version       uint   `gorm:"default:0" json:"version"`      // Incremented when the encoding settings change, videos with a kept original are then re-transcoded
+}
+
+func (p *VideoProfile) IsValidCodec() bool {
+	return p.Codec == VideoCodecH264 || p.Codec == VideoCodecHEVC || p.Codec == VideoCodecAV1
+}
+
+// SameEncoding returns true if both profiles produce the same video
+func (p *VideoProfile) SameEncoding(other *VideoProfile) bool {
+	return p.MaxResolution == other.MaxResolution && p.Codec == other.Codec && p.CRF == other.CRF && p.AudioBitrate == other.AudioBitrate
+}
+
+// MaxCRF returns the worst quality CRF value allowed by the codec
+func (p *VideoProfile) MaxCRF() uint8 {
+	if p.Codec == VideoCodecAV1 {
+		return 63
+	}
+	return 51
+}
@@ -0,0 +1,193 @@
+package processing
+
+import (
+	"image"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"server/db"
+	"server/models"
+	"server/storage"
+	"server/utils"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	panoramaMinAspect     = 2.5  // Long to short side ratio for (camera) panoramas
+	documentMinPaperRatio = 0.45 // Portion of bright, colourless pixels for documents/receipts
+	documentMaxSaturation = 0.12 // Average saturation for documents/receipts
+)
+
+var (
+	// Common phone, tablet and monitor screen sizes (in pixels), used to detect screenshots
+	deviceResolutions = [][2]int{
+		{750, 1334}, {828, 1792}, {1125, 2436}, {1170, 2532}, {1179, 2556}, {1242, 2208}, {1242, 2688}, {1284, 2778}, {1290, 2796},
+		{1080, 1920}, {1080, 2340}, {1080, 2400}, {1440, 2560}, {1440, 3040}, {1440, 3120}, {1440, 3200},
+		{1536, 2048}, {1620, 2160}, {1640, 2360}, {1668, 2224}, {1668, 2388}, {2048, 2732},
+		{768, 1366}, {900, 1440}, {1200, 1920}, {1600, 2560}, {1800, 2880}, {1964, 3024}, {2160, 3840}, {2234, 3456},
+	}
+)
+
+// classify labels images as screenshot, panorama, 360, portrait or document based on metadata heuristics
+type classify struct{}
+
+// classifyInput contains everything the heuristics are based on
+type classifyInput struct {
+	name        string
+	mimeType    string
+	width       int
+	height      int
+	hasCamera   bool   // Camera make/model present in EXIF
+	projection  string // XMP-GPano:ProjectionType
+	depth       bool   // Depth map or portrait mode XMP tags
+	userComment string
+	document    bool // Thumbnail looks like paper
+}
+
+func (t *classify) shouldHandle(asset *models.Asset) bool {
+	return asset.IsImage() && asset.ThumbSize > 0 && asset.ThumbPath != ""
+}
+
+func (t *classify) requiresContent(asset *models.Asset) bool {
+	return true
+}
+
+func (t *classify) process(asset *models.Asset, storage storage.StorageAPI) (status int, clean func()) {
+	in := classifyInput{
+		name:     asset.Name,
+		mimeType: asset.MimeType,
+		width:    int(asset.Width),
+		height:   int(asset.Height),
+	}
+	cmd := exec.Command("exiftool", "-T", "-XMP-GPano:ProjectionType", "-XMP-GDepth:Mime", "-XMP-GCamera:SpecialTypeID", "-UserComment", storage.GetFullPath(asset.Path))
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("Classification metadata error: %v; output: %s", err, output)
+		return Failed, nil
+	}
+	result := strings.Split(strings.Trim(string(output), "\n\t\r "), "\t")
+	if len(result) == 4 {
+		if result[0] != "-" {
+			in.projection = strings.ToLower(result[0])
+		}
+		in.depth = result[1] != "-" || strings.Contains(strings.ToLower(result[2]), "portrait")
+		if result[3] != "-" {
+			in.userComment = result[3]
+		}
+	}
+	exif := models.AssetExif{}
+	if err = db.Instance.Where("asset_id = ?", asset.ID).Find(&exif).Error; err != nil {
+		return FailedDB, nil
+	}
+	in.hasCamera = exif.Model != ""
+
+	// Documents are checked on the thumbnail, only for camera photos without faces
+	var faces int64
+	if err = db.Instance.Model(&models.Face{}).Where("asset_id = ?", asset.ID).Count(&faces).Error; err != nil {
+		return FailedDB, nil
+	}
+	if in.hasCamera && faces == 0 {
+		if storage.GetSize(asset.ThumbPath) <= 0 {
+			if storage.EnsureLocalFile(asset.ThumbPath) != nil {
+				return Failed, nil
+			}
+		}
+		clean = func() {
+			storage.ReleaseLocalFile(asset.ThumbPath)
+		}
+		file, err := os.Open(storage.GetFullPath(asset.ThumbPath))
+		if err != nil {
+			log.Printf("Error opening thumbnail for asset %d, path:%s: %v", asset.ID, asset.ThumbPath, err)
+			return Failed, clean
+		}
+		img, _, err := utils.DecodeImage(file)
+		file.Close()
+		if err != nil {
+			log.Printf("Error decoding thumbnail for asset %d, path:%s: %v", asset.ID, asset.ThumbPath, err)
+			return Failed, clean
+		}
+		in.document = looksLikeDocument(img)
+	}
+	classes := classifyAsset(&in)
+	err = db.Instance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("asset_id = ? and source = ?", asset.ID, models.AssetTagSourceClassify).Delete(&models.AssetTag{}).Error; err != nil {
+			return err
+		}
+		for _, class := range classes {
+			if err := tx.Create(&models.AssetTag{AssetID: asset.ID, Source: models.AssetTagSourceClassify, Name: class}).Error; err != nil {
+				return err
+			}
+		}
+		return touchAsset(tx, asset.ID)
+	})
+	if err != nil {
+		log.Printf("Error saving classes for asset ID %d: %v", asset.ID, err)
+		return FailedDB, clean
+	}
+	return Done, clean
+}
+
+func classifyAsset(in *classifyInput) (classes []string) {
+	if in.userComment == "Screenshot" || strings.Contains(strings.ToLower(in.name), "screenshot") ||
+		(!in.hasCamera && (in.mimeType == "image/png" || isDeviceResolution(in.width, in.height))) {
+		// Screenshots are not anything else
+		return []string{models.AssetClassScreenshot}
+	}
+	long, short := max(in.width, in.height), min(in.width, in.height)
+	aspect := 0.0
+	if short > 0 {
+		aspect = float64(long) / float64(short)
+	}
+	if in.projection == "equirectangular" && math.Abs(aspect-2) < 0.02 {
+		// Full sphere
+		classes = append(classes, models.AssetClass360)
+	} else if in.projection != "" || (in.hasCamera && aspect >= panoramaMinAspect) {
+		classes = append(classes, models.AssetClassPanorama)
+	}
+	if in.depth {
+		classes = append(classes, models.AssetClassPortrait)
+	}
+	if in.document {
+		classes = append(classes, models.AssetClassDocument)
+	}
+	return
+}
+
+func isDeviceResolution(width, height int) bool {
+	for _, r := range deviceResolutions {
+		if (width == r[0] && height == r[1]) || (width == r[1] && height == r[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLikeDocument checks for mostly bright, colourless (paper-like) content
+func looksLikeDocument(img image.Image) bool {
+	bounds := img.Bounds()
+	total := bounds.Dx() * bounds.Dy()
+	if total == 0 {
+		return false
+	}
+	paper := 0
+	saturation := 0.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			hi := float64(max(r, g, b)) / 0xffff
+			lo := float64(min(r, g, b)) / 0xffff
+			s := 0.0
+			if hi > 0 {
+				s = (hi - lo) / hi
+			}
+			saturation += s
+			if hi > 0.7 && s < 0.15 {
+				paper++
+			}
+		}
+	}
+	return float64(paper)/float64(total) >= documentMinPaperRatio && saturation/float64(total) <= documentMaxSaturation
+}
@@ -0,0 +1,31 @@
+package processing
+
+import (
+	"reflect"
+	"server/models"
+	"testing"
+)
+
+func Test_classifyAsset(t *testing.T) {
+	tests := []struct {
+		name string
+		in   classifyInput
+		want []string
+	}{
+		{"camera photo", classifyInput{mimeType: "image/jpeg", width: 4032, height: 3024, hasCamera: true}, nil},
+		{"png", classifyInput{mimeType: "image/png", width: 800, height: 600}, []string{models.AssetClassScreenshot}},
+		{"phone screen", classifyInput{mimeType: "image/jpeg", width: 1179, height: 2556}, []string{models.AssetClassScreenshot}},
+		{"user comment", classifyInput{mimeType: "image/jpeg", width: 100, height: 100, hasCamera: true, userComment: "Screenshot"}, []string{models.AssetClassScreenshot}},
+		{"camera panorama", classifyInput{mimeType: "image/jpeg", width: 12000, height: 3000, hasCamera: true}, []string{models.AssetClassPanorama}},
+		{"photo sphere", classifyInput{mimeType: "image/jpeg", width: 8000, height: 4000, hasCamera: true, projection: "equirectangular"}, []string{models.AssetClass360}},
+		{"partial sphere", classifyInput{mimeType: "image/jpeg", width: 8000, height: 2000, hasCamera: true, projection: "equirectangular"}, []string{models.AssetClassPanorama}},
+		{"portrait document", classifyInput{mimeType: "image/jpeg", width: 3024, height: 4032, hasCamera: true, depth: true, document: true}, []string{models.AssetClassPortrait, models.AssetClassDocument}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyAsset(&tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("classifyAsset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
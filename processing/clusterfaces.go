@@ -0,0 +1,127 @@
+package processing
+
+import (
+	"log"
+	"server/config"
+	"server/db"
+	"server/faces"
+	"server/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	faceClusterInterval = time.Hour
+	faceClusterMinSize  = 4    // Fewer similar faces are not suggested as a new person
+	faceClusterMaxFaces = 5000 // Most recent unassigned faces per user, as clustering is O(n^2)
+)
+
+var (
+	lastFaceClustering = time.Time{}
+)
+
+// clusterFaces groups the unassigned faces of users who have new ones since the last run
+func clusterFaces() {
+	since := lastFaceClustering.Unix()
+	lastFaceClustering = time.Now()
+	userIDs := []uint64{}
+	err := db.Instance.Model(&models.Face{}).
+		Where("person_id is null and cluster_id is null and created_at > ?", since).
+		Distinct().Pluck("user_id", &userIDs).Error
+	if err != nil {
+		log.Printf("Error loading users for face clustering: %v", err)
+		return
+	}
+	for _, userID := range userIDs {
+		if err = ClusterUserFaces(userID); err != nil {
+			log.Printf("Error clustering faces for user ID %d: %v", userID, err)
+		}
+	}
+}
+
+// ClusterUserFaces replaces the suggested (not dismissed) face clusters of a user with new ones.
+// Clusters keep their IDs while they share most faces, so the suggestions shown to the user stay valid
+func ClusterUserFaces(userID uint64) error {
+	// Clustering takes a while, it's done before opening the transaction to not block other writes
+	unassigned := []models.Face{}
+	err := db.Instance.Where("user_id = ? and person_id is null and (cluster_id is null or cluster_id in (select id from face_clusters where user_id = ? and dismissed = ?))", userID, userID, false).
+		Order("id desc").Limit(faceClusterMaxFaces).Find(&unassigned).Error
+	if err != nil {
+		return err
+	}
+	descriptors := make([][]float32, len(unassigned))
+	for i := range unassigned {
+		descriptors[i] = unassigned[i].Descriptor()
+	}
+	groups := faces.Cluster(descriptors, config.FACE_MAX_DISTANCE_SQ, faceClusterMinSize)
+	err = db.Instance.Transaction(func(tx *gorm.DB) error {
+		previous := []uint64{}
+		if err := tx.Model(&models.FaceCluster{}).Where("user_id = ? and dismissed = ?", userID, false).Pluck("id", &previous).Error; err != nil {
+			return err
+		}
+		available := map[uint64]bool{}
+		for _, id := range previous {
+			available[id] = true
+		}
+		err := tx.Exec("update faces set cluster_id=null where cluster_id in (select id from face_clusters where user_id=? and dismissed=?)", userID, false).Error
+		if err != nil {
+			return err
+		}
+		kept := []uint64{}
+		for _, group := range groups {
+			ids := make([]uint64, len(group))
+			members := make([]*models.Face, len(group))
+			for i, index := range group {
+				ids[i] = unassigned[index].ID
+				members[i] = &unassigned[index]
+			}
+			cluster := models.FaceCluster{ID: overlappingCluster(members, available), UserID: userID, Size: len(group)}
+			if cluster.ID != 0 {
+				delete(available, cluster.ID)
+				err = tx.Model(&cluster).Update("size", cluster.Size).Error
+			} else {
+				err = tx.Create(&cluster).Error
+			}
+			if err != nil {
+				return err
+			}
+			kept = append(kept, cluster.ID)
+			// Faces may have been assigned meanwhile
+			if err = tx.Model(&models.Face{}).Where("id in (?) and person_id is null", ids).Update("cluster_id", cluster.ID).Error; err != nil {
+				return err
+			}
+		}
+		removed := tx.Where("user_id = ? and dismissed = ?", userID, false)
+		if len(kept) > 0 {
+			removed = removed.Where("id not in (?)", kept)
+		}
+		return removed.Delete(&models.FaceCluster{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Face clustering for user ID %d: %d faces, %d clusters", userID, len(unassigned), len(groups))
+	return nil
+}
+
+// overlappingCluster returns the available previous cluster with most of the faces (0 if none)
+func overlappingCluster(members []*models.Face, available map[uint64]bool) uint64 {
+	counts := map[uint64]int{}
+	best := uint64(0)
+	for _, face := range members {
+		if face.ClusterID == nil || !available[*face.ClusterID] {
+			continue
+		}
+		id := *face.ClusterID
+		counts[id]++
+		if best == 0 || counts[id] > counts[best] || (counts[id] == counts[best] && id < best) {
+			best = id
+		}
+	}
+	// At least half of the faces, otherwise it's a different suggestion
+	if best == 0 || 2*counts[best] < len(members) {
+		return 0
+	}
+	return best
+}
@@ -1,14 +1,21 @@
 package processing
 
 import (
+	"image"
 	"log"
-	"reflect"
 	"server/config"
 	"server/db"
 	"server/faces"
 	"server/models"
 	"server/storage"
-	"strconv"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+const (
+	closestPersonBatchSize = 500
+	faceBoxMinIoU          = 0.5 // Minimum overlap of face boxes to keep the person when faces are detected again
 )
 
 type detectfaces struct{}
@@ -37,15 +44,35 @@ func (t *detectfaces) process(asset *models.Asset, storage storage.StorageAPI) (
 	clean = func() {
 		storage.ReleaseLocalFile(asset.ThumbPath)
 	}
+	// Face boxes must match the displayed thumbnail
+	if err := ensureUprightThumb(asset, storage); err != nil {
+		log.Printf("Error normalizing thumbnail orientation for asset %d, path:%s: %v", asset.ID, asset.ThumbPath, err)
+		return Failed, clean
+	}
 	// Extract faces
-	result, err := faces.Detect(storage.GetFullPath(asset.ThumbPath))
+	result, err := faces.Detect(storage.GetFullPath(asset.ThumbPath), detectOptions(asset.ID))
 	if err != nil {
 		log.Printf("Error detecting faces for asset %d, path:%s: %s", asset.ID, asset.ThumbPath, err.Error())
-		return Failed, nil
+		return Failed, clean
 	}
-	// Save faces' data to DB
+	// Faces from a previous detection are replaced, keeping the people assigned to overlapping boxes
+	previous := []models.Face{}
+	if err = db.Instance.Where("asset_id = ?", asset.ID).Find(&previous).Error; err != nil {
+		log.Printf("Error loading previous faces for asset %d: %v", asset.ID, err)
+		return Failed, clean
+	}
+	previousBoxes := make([]image.Rectangle, len(previous))
+	for i, f := range previous {
+		previousBoxes[i] = image.Rect(f.X1, f.Y1, f.X2, f.Y2)
+	}
+	boxes := make([]image.Rectangle, len(result))
+	for i, face := range result {
+		boxes[i] = face.Rectangle
+	}
+	matched := matchFaceBoxes(previousBoxes, boxes, faceBoxMinIoU)
+	newFaces := make([]models.Face, len(result))
 	for i, face := range result {
-		faceModel := models.Face{
+		newFaces[i] = models.Face{
 			UserID:   asset.UserID,
 			AssetID:  asset.ID,
 			Num:      i,
@@ -55,19 +82,34 @@ func (t *detectfaces) process(asset *models.Asset, storage storage.StorageAPI) (
 			Y2:       face.Rectangle.Max.Y,
 			PersonID: nil,
 		}
-		// Use reflection to set Vx fields to the corresponding value from the array
-		for j, value := range face.Descriptor {
-			reflect.ValueOf(&faceModel).Elem().FieldByName("V" + strconv.Itoa(j)).SetFloat(float64(value))
+		if matched[i] >= 0 {
+			old := &previous[matched[i]]
+			newFaces[i].PersonID, newFaces[i].Distance = old.PersonID, old.Distance
 		}
-		if err := db.Instance.Create(&faceModel).Error; err != nil {
-			log.Printf("Error saving face location for asset %d: %v", asset.ID, err)
-			return Failed, nil
+		newFaces[i].SetDescriptor(face.Descriptor)
+	}
+	// Save faces' data to DB
+	if err = replaceFaces(asset, previous, newFaces, matched); err != nil {
+		log.Printf("Error saving faces for asset %d: %v", asset.ID, err)
+		return Failed, clean
+	}
+	if len(previous) > 0 {
+		models.FaceIndex.RemoveAsset(asset.UserID, asset.ID)
+		for _, f := range previous {
+			if f.CropPath != "" {
+				_ = storage.Delete(f.CropPath)
+				_ = storage.DeleteRemoteFile(f.CropPath)
+			}
+		}
+	}
+	for i := range newFaces {
+		faceModel := &newFaces[i]
+		models.FaceIndex.Add(faceModel)
+		if faceModel.PersonID != nil {
+			continue
 		}
 		// Find the face that is most similar (least distance) to this one and fetch it's person_id
-		db.Instance.Raw(`select t2.person_id, `+models.FacesVectorDistance+` as threshold 
-						 from faces t1 join faces t2 
-						 where t1.id=? and t1.user_id=t2.user_id and t1.user_id=? and t2.person_id is not null and t1.id != t2.id 
-						 order by threshold limit 1`, faceModel.ID, asset.UserID).Row().Scan(&faceModel.PersonID, &faceModel.Distance)
+		faceModel.PersonID, faceModel.Distance = closestPerson(faceModel)
 		log.Printf("Face %d, threshold: %f\n", faceModel.ID, faceModel.Distance)
 		if faceModel.PersonID != nil && faceModel.Distance <= config.FACE_MAX_DISTANCE_SQ {
 			// Update the current face with the found person_id
@@ -77,3 +119,177 @@ func (t *detectfaces) process(asset *models.Asset, storage storage.StorageAPI) (
 	}
 	return Done, clean
 }
+
+// RequestFaceDetection saves the detection options for the assets and queues them for face detection (again)
+func RequestFaceDetection(assetIDs []uint64, opts faces.Options) error {
+	for start := 0; start < len(assetIDs); start += resetBatchSize {
+		batch := assetIDs[start:min(start+resetBatchSize, len(assetIDs))]
+		err := db.Instance.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("asset_id IN (?)", batch).Delete(&models.FaceDetectOptions{}).Error; err != nil {
+				return err
+			}
+			options := make([]models.FaceDetectOptions, 0, len(batch))
+			for _, id := range batch {
+				options = append(options, models.FaceDetectOptions{AssetID: id, CNN: opts.CNN, Upsample: opts.Upsample, MinSize: opts.MinSize})
+			}
+			return tx.Create(&options).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return ResetTasks(assetIDs, "detectfaces")
+}
+
+// detectOptions returns the options saved for the asset by RequestFaceDetection, or the configured ones
+func detectOptions(assetID uint64) faces.Options {
+	saved := models.FaceDetectOptions{}
+	if db.Instance.Where("asset_id = ?", assetID).Find(&saved).Error != nil || saved.AssetID == 0 {
+		return faces.DefaultOptions()
+	}
+	return faces.Options{CNN: saved.CNN, Upsample: saved.Upsample, MinSize: saved.MinSize}
+}
+
+// replaceFaces deletes the previous faces of the asset and creates the new ones in one transaction, so nothing is lost on errors.
+// Rejections and avatars of the previous faces are moved to the matching new ones (matched holds previous indexes or -1)
+func replaceFaces(asset *models.Asset, previous, newFaces []models.Face, matched []int) error {
+	return db.Instance.Transaction(func(tx *gorm.DB) error {
+		rejections := []models.FaceRejection{}
+		if len(previous) > 0 {
+			err := tx.Where("face_id in (select id from faces where asset_id = ?)", asset.ID).Find(&rejections).Error
+			if err != nil {
+				return err
+			}
+			if err = tx.Where("face_id in (select id from faces where asset_id = ?)", asset.ID).Delete(&models.FaceRejection{}).Error; err != nil {
+				return err
+			}
+			if err = tx.Where("asset_id = ?", asset.ID).Delete(&models.Face{}).Error; err != nil {
+				return err
+			}
+		}
+		for i := range newFaces {
+			if err := tx.Create(&newFaces[i]).Error; err != nil {
+				return err
+			}
+			if matched[i] < 0 {
+				continue
+			}
+			old := &previous[matched[i]]
+			for _, r := range rejections {
+				if r.FaceID != old.ID {
+					continue
+				}
+				if err := tx.Create(&models.FaceRejection{FaceID: newFaces[i].ID, PersonID: r.PersonID}).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Exec("update people set avatar_face_id=? where avatar_face_id=?", newFaces[i].ID, old.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// matchFaceBoxes returns the index of the matching previous box for each new box (or -1).
+// Boxes are matched one to one, best overlap (intersection over union) first
+func matchFaceBoxes(previous, boxes []image.Rectangle, minIoU float64) []int {
+	type pair struct {
+		p, b int
+		iou  float64
+	}
+	pairs := []pair{}
+	for p := range previous {
+		for b := range boxes {
+			if iou := boxIoU(previous[p], boxes[b]); iou >= minIoU {
+				pairs = append(pairs, pair{p, b, iou})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].iou > pairs[j].iou
+	})
+	result := make([]int, len(boxes))
+	for i := range result {
+		result[i] = -1
+	}
+	used := map[int]bool{}
+	for _, p := range pairs {
+		if result[p.b] < 0 && !used[p.p] {
+			result[p.b] = p.p
+			used[p.p] = true
+		}
+	}
+	return result
+}
+
+func boxIoU(a, b image.Rectangle) float64 {
+	intersection := a.Intersect(b)
+	if intersection.Empty() {
+		return 0
+	}
+	i := float64(intersection.Dx() * intersection.Dy())
+	union := float64(a.Dx()*a.Dy()+b.Dx()*b.Dy()) - i
+	return i / union
+}
+
+// closestPerson returns the person of the most similar face that has one assigned, and the (squared) distance to it.
+// Faces of people shared with the user (from their owners' libraries) are considered as well
+func closestPerson(face *models.Face) (*uint64, float64) {
+	best, bestDistance := closestInIndex(face, face.UserID, nil)
+	shared, err := models.PeopleSharedWith(face.UserID)
+	if err != nil {
+		log.Printf("Error loading people shared with user %d: %v", face.UserID, err)
+	}
+	owners := map[uint64]map[uint64]bool{}
+	for _, person := range shared {
+		if owners[person.UserID] == nil {
+			owners[person.UserID] = map[uint64]bool{}
+		}
+		owners[person.UserID][person.ID] = true
+	}
+	for owner, allowed := range owners {
+		person, distance := closestInIndex(face, owner, allowed)
+		if person != nil && (best == nil || distance < bestDistance) {
+			best, bestDistance = person, distance
+		}
+	}
+	return best, bestDistance
+}
+
+// closestInIndex searches the faces of indexUserID, only for the allowed people (all if nil).
+// Rejected faces are negative examples: a person is skipped if a face rejected for them is more similar than their closest face
+func closestInIndex(face *models.Face, indexUserID uint64, allowed map[uint64]bool) (*uint64, float64) {
+	matches := models.FaceIndex.Search(indexUserID, face.Descriptor(), config.FACE_MAX_DISTANCE_SQ)
+	blocked := map[uint64]bool{}
+	for start := 0; start < len(matches); start += closestPersonBatchSize {
+		batch := matches[start:min(start+closestPersonBatchSize, len(matches))]
+		ids := make([]uint64, 0, len(batch))
+		for _, m := range batch {
+			ids = append(ids, m.FaceID)
+		}
+		assigned := []models.Face{}
+		db.Instance.Select("id", "person_id").Where("id in (?) and person_id is not null", ids).Find(&assigned)
+		persons := map[uint64]*uint64{}
+		for _, f := range assigned {
+			persons[f.ID] = f.PersonID
+		}
+		rejections := []models.FaceRejection{}
+		db.Instance.Select("face_id", "person_id").Where("face_id in (?)", ids).Find(&rejections)
+		rejected := map[uint64][]uint64{}
+		for _, r := range rejections {
+			rejected[r.FaceID] = append(rejected[r.FaceID], r.PersonID)
+		}
+		// Matches are sorted by distance
+		for _, m := range batch {
+			for _, personID := range rejected[m.FaceID] {
+				blocked[personID] = true
+			}
+			person := persons[m.FaceID]
+			if m.FaceID != face.ID && person != nil && !blocked[*person] && (allowed == nil || allowed[*person]) {
+				return person, m.DistanceSq
+			}
+		}
+	}
+	return nil, 0
+}
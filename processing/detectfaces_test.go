@@ -0,0 +1,39 @@
+package processing
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestMatchFaceBoxes(t *testing.T) {
+	previous := []image.Rectangle{
+		image.Rect(0, 0, 100, 100),
+		image.Rect(200, 200, 300, 300),
+		image.Rect(500, 0, 600, 100),
+	}
+	boxes := []image.Rectangle{
+		image.Rect(210, 210, 310, 310), // Moved a bit
+		image.Rect(0, 0, 40, 40),       // Too small to be the same face
+		image.Rect(5, 5, 105, 105),     // Same face, better match than the one above
+		image.Rect(195, 195, 305, 305), // Also overlaps the second one, but less than the first box
+		image.Rect(800, 800, 900, 900), // New face
+	}
+	want := []int{-1, -1, 0, 1, -1}
+	// The first box overlaps less (IoU 0.68) than the fourth one (0.83)
+	if got := matchFaceBoxes(previous, boxes, 0.5); !reflect.DeepEqual(got, want) {
+		t.Errorf("matchFaceBoxes() = %v, want %v", got, want)
+	}
+	if got := matchFaceBoxes(nil, boxes[:2], 0.5); !reflect.DeepEqual(got, []int{-1, -1}) {
+		t.Errorf("matchFaceBoxes() without previous faces = %v", got)
+	}
+}
+
+func TestBoxIoU(t *testing.T) {
+	if got := boxIoU(image.Rect(0, 0, 10, 10), image.Rect(5, 0, 15, 10)); got < 0.333 || got > 0.334 {
+		t.Errorf("boxIoU() = %f, want 1/3", got)
+	}
+	if got := boxIoU(image.Rect(0, 0, 10, 10), image.Rect(20, 20, 30, 30)); got != 0 {
+		t.Errorf("boxIoU() = %f, want 0", got)
+	}
+}
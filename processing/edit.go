@@ -0,0 +1,121 @@
+package processing
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"log"
+	"os"
+	"os/exec"
+	"server/db"
+	"server/models"
+	"server/storage"
+	"server/utils"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	editDisplaySize = 2560 // Maximum size of the edited display variant
+)
+
+// RenderEdit renders the edited thumbnail and display variant of an image and saves the edit.
+// The original file is not modified. NOTE: asset.Bucket must be preloaded
+func RenderEdit(asset *models.Asset, edit *models.AssetEdit) error {
+	storage := storage.StorageFrom(&asset.Bucket)
+	if storage == nil {
+		return errors.New("storage is nil")
+	}
+	edit.SetPaths(asset)
+	// Thumbnails are stored upright already
+	thumb, err := loadImage(storage, asset.ThumbPath)
+	if err != nil {
+		return err
+	}
+	if edit.ThumbSize, err = saveEditedImage(storage, edit.ThumbPath, edit.Apply(thumb)); err != nil {
+		return err
+	}
+	img, err := loadDisplayImage(asset, storage, edit.DisplayPath)
+	if err != nil {
+		return err
+	}
+	img = resize.Thumbnail(editDisplaySize, editDisplaySize, img, resize.Lanczos3)
+	if edit.DisplaySize, err = saveEditedImage(storage, edit.DisplayPath, edit.Apply(img)); err != nil {
+		return err
+	}
+	return db.Instance.Save(edit).Error
+}
+
+// DeleteEdit removes the edit and its rendered files. NOTE: asset.Bucket must be preloaded
+func DeleteEdit(asset *models.Asset, edit *models.AssetEdit) error {
+	if err := db.Instance.Delete(edit).Error; err != nil {
+		return err
+	}
+	storage := storage.StorageFrom(&asset.Bucket)
+	if storage == nil {
+		return errors.New("storage is nil")
+	}
+	for _, path := range []string{edit.ThumbPath, edit.DisplayPath} {
+		if path == "" {
+			continue
+		}
+		err1 := storage.Delete(path)
+		err2 := storage.DeleteRemoteFile(path)
+		if err1 != nil || err2 != nil {
+			log.Printf("Error deleting edited file for asset ID %d (%s), errors (local,remote): %v, %v", asset.ID, path, err1, err2)
+		}
+	}
+	return nil
+}
+
+func loadImage(storage storage.StorageAPI, path string) (image.Image, error) {
+	if err := storage.EnsureLocalFile(path); err != nil {
+		return nil, err
+	}
+	defer storage.ReleaseLocalFile(path)
+	file, err := os.Open(storage.GetFullPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := utils.DecodeImage(file)
+	return img, err
+}
+
+// loadDisplayImage decodes the original, using ffmpeg for formats Go can't decode (e.g. HEIC) and the preview for RAW files
+func loadDisplayImage(asset *models.Asset, storage storage.StorageAPI, tmpPath string) (image.Image, error) {
+	switch asset.MimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return loadImage(storage, asset.Path)
+	}
+	if asset.IsRaw() {
+		return loadImage(storage, asset.PreviewPath)
+	}
+	if err := storage.EnsureLocalFile(asset.Path); err != nil {
+		return nil, err
+	}
+	defer storage.ReleaseLocalFile(asset.Path)
+	cmd := exec.Command("ffmpeg", "-y", "-i", storage.GetFullPath(asset.Path), "-vframes", "1", storage.GetFullPath(tmpPath))
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(storage.GetFullPath(tmpPath))
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := utils.DecodeImage(bytes.NewReader(data))
+	return img, err
+}
+
+func saveEditedImage(storage storage.StorageAPI, path string, img image.Image) (int64, error) {
+	buf := bytes.Buffer{}
+	if err := utils.EncodeJPEG(&buf, img); err != nil {
+		return 0, err
+	}
+	size, err := storage.Save(path, &buf)
+	if err != nil {
+		return 0, err
+	}
+	defer storage.ReleaseLocalFile(path)
+	return size, storage.UpdateRemoteFile(path, "image/jpeg")
+}
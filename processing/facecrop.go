@@ -0,0 +1,58 @@
+package processing
+
+import (
+	"errors"
+	"image"
+	"server/db"
+	"server/models"
+	"server/storage"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	faceCropSize    = 256  // Maximum size of the (square) face crops
+	faceCropPadding = 0.25 // Added around the face box on each side, relative to its size
+)
+
+// RenderFaceCrop renders and saves the square crop of a face from the asset's thumbnail, if not done already.
+// NOTE: asset.Bucket must be preloaded
+func RenderFaceCrop(face *models.Face, asset *models.Asset) error {
+	if face.CropPath != "" {
+		return nil
+	}
+	storage := storage.StorageFrom(&asset.Bucket)
+	if storage == nil {
+		return errors.New("storage is nil")
+	}
+	// Face boxes are relative to the (upright) thumbnail
+	thumb, err := loadImage(storage, asset.ThumbPath)
+	if err != nil {
+		return err
+	}
+	rect := faceCropRect(image.Rect(face.X1, face.Y1, face.X2, face.Y2), thumb.Bounds(), faceCropPadding)
+	sub, ok := thumb.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok || rect.Empty() {
+		return errors.New("cannot crop the thumbnail")
+	}
+	size := uint(min(rect.Dx(), faceCropSize))
+	crop := resize.Resize(size, size, sub.SubImage(rect), resize.Lanczos3)
+	path := face.CreateCropPath(asset)
+	if _, err = saveEditedImage(storage, path, crop); err != nil {
+		return err
+	}
+	face.CropPath = path
+	return db.Instance.Model(face).Update("crop_path", path).Error
+}
+
+// faceCropRect returns a square around the face box with the given padding, moved and shrunk to fit in bounds if needed
+func faceCropRect(box, bounds image.Rectangle, padding float64) image.Rectangle {
+	side := int(float64(max(box.Dx(), box.Dy())) * (1 + 2*padding))
+	side = min(side, bounds.Dx(), bounds.Dy())
+	centerX, centerY := (box.Min.X+box.Max.X)/2, (box.Min.Y+box.Max.Y)/2
+	x := min(max(centerX-side/2, bounds.Min.X), bounds.Max.X-side)
+	y := min(max(centerY-side/2, bounds.Min.Y), bounds.Max.Y-side)
+	return image.Rect(x, y, x+side, y+side)
+}
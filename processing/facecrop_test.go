@@ -0,0 +1,28 @@
+package processing
+
+import (
+	"image"
+	"testing"
+)
+
+func TestFaceCropRect(t *testing.T) {
+	bounds := image.Rect(0, 0, 1000, 600)
+	tests := []struct {
+		name string
+		box  image.Rectangle
+		want image.Rectangle
+	}{
+		{"centered", image.Rect(400, 200, 500, 300), image.Rect(375, 175, 525, 325)},
+		{"not square", image.Rect(400, 200, 500, 260), image.Rect(375, 155, 525, 305)},
+		{"top left corner", image.Rect(0, 0, 100, 100), image.Rect(0, 0, 150, 150)},
+		{"bottom right corner", image.Rect(950, 550, 1000, 600), image.Rect(925, 525, 1000, 600)},
+		{"bigger than the image", image.Rect(100, 0, 800, 600), image.Rect(150, 0, 750, 600)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := faceCropRect(tt.box, bounds, 0.25); got != tt.want {
+				t.Errorf("faceCropRect(%v) = %v, want %v", tt.box, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package processing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"server/db"
+	"server/models"
+	"server/storage"
+	"server/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	hookMaxOutput = 1 << 20 // Ignore anything above 1MB returned by a hook
+)
+
+// hook runs an external command or webhook registered by an admin
+type hook struct {
+	models.ProcessingHook
+}
+
+// hookAsset is sent to the hook (on stdin for commands, as JSON or multipart form field for webhooks)
+type hookAsset struct {
+	ID        uint64   `json:"id"`
+	UserID    uint64   `json:"user_id"`
+	Name      string   `json:"name"`
+	MimeType  string   `json:"mime_type"`
+	Size      int64    `json:"size"`
+	Width     uint16   `json:"width"`
+	Height    uint16   `json:"height"`
+	Duration  uint32   `json:"duration"`
+	CreatedAt int64    `json:"created_at"`
+	GpsLat    *float64 `json:"gps_lat"`
+	GpsLong   *float64 `json:"gps_long"`
+	Path      string   `json:"path,omitempty"` // Full local path, only for commands requiring content
+}
+
+// hookResult is the (optional) JSON returned by the hook
+type hookResult struct {
+	Tags     []string                   `json:"tags"`
+	Metadata map[string]json.RawMessage `json:"metadata"`
+}
+
+func (h *hook) shouldHandle(asset *models.Asset) bool {
+	return h.MatchesMimeType(asset.MimeType)
+}
+
+func (h *hook) requiresContent(asset *models.Asset) bool {
+	return h.RequiresContent
+}
+
+func (h *hook) process(asset *models.Asset, storage storage.StorageAPI) (int, func()) {
+	payload := hookAsset{
+		ID:        asset.ID,
+		UserID:    asset.UserID,
+		Name:      asset.Name,
+		MimeType:  asset.MimeType,
+		Size:      asset.Size,
+		Width:     asset.Width,
+		Height:    asset.Height,
+		Duration:  asset.Duration,
+		CreatedAt: asset.CreatedAt,
+		GpsLat:    asset.GpsLat,
+		GpsLong:   asset.GpsLong,
+	}
+	fullPath := ""
+	if h.RequiresContent {
+		fullPath = storage.GetFullPath(asset.Path)
+	}
+	timeout := time.Duration(h.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = models.DefaultProcessingHookTimeout * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var output []byte
+	var err error
+	if h.Type == models.ProcessingHookWebhook {
+		output, err = h.callWebhook(ctx, &payload, fullPath)
+	} else {
+		payload.Path = fullPath
+		output, err = h.runCommand(ctx, &payload)
+	}
+	if err != nil {
+		log.Printf("Hook \"%s\" error for asset ID %d: %v", h.Name, asset.ID, err)
+		return Failed, nil
+	}
+	result, err := parseHookResult(output)
+	if err != nil {
+		log.Printf("Hook \"%s\" returned invalid JSON for asset ID %d: %v", h.Name, asset.ID, err)
+		return Failed, nil
+	}
+	if err = h.saveResult(asset.ID, result); err != nil {
+		log.Printf("Hook \"%s\" DB error for asset ID %d: %v", h.Name, asset.ID, err)
+		return FailedDB, nil
+	}
+	return Done, nil
+}
+
+func (h *hook) runCommand(ctx context.Context, payload *hookAsset) ([]byte, error) {
+	input, _ := json.Marshal(payload)
+	args := []string{}
+	if payload.Path != "" {
+		args = append(args, payload.Path)
+	}
+	cmd := exec.CommandContext(ctx, h.Target, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
+
+func (h *hook) callWebhook(ctx context.Context, payload *hookAsset, fullPath string) ([]byte, error) {
+	input, _ := json.Marshal(payload)
+	var body io.Reader = bytes.NewReader(input)
+	contentType := "application/json"
+	if fullPath != "" {
+		// Send the asset details and the file contents as a multipart form, streamed as videos can be huge
+		file, err := os.Open(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader, pipe := io.Pipe()
+		defer reader.Close()
+		writer := multipart.NewWriter(pipe)
+		go func() {
+			pipe.CloseWithError(writeMultipart(writer, string(input), filepath.Base(payload.Name), file))
+		}()
+		body = reader
+		contentType = writer.FormDataContentType()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", h.Target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, hookMaxOutput))
+}
+
+func writeMultipart(writer *multipart.Writer, asset, fileName string, file io.Reader) error {
+	if err := writer.WriteField("asset", asset); err != nil {
+		return err
+	}
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(part, file); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// parseHookResult accepts empty output as well (hooks that don't return anything)
+func parseHookResult(output []byte) (*hookResult, error) {
+	result := &hookResult{}
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return result, nil
+	}
+	if len(output) > hookMaxOutput {
+		return nil, fmt.Errorf("output too large: %d bytes", len(output))
+	}
+	err := json.Unmarshal(output, result)
+	return result, err
+}
+
+// saveResult replaces all tags and metadata previously returned by this hook for the asset
+func (h *hook) saveResult(assetID uint64, result *hookResult) error {
+	source := h.TaskName()
+	return db.Instance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("asset_id = ? and source = ?", assetID, source).Delete(&models.AssetTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("asset_id = ? and source = ?", assetID, source).Delete(&models.AssetMetadata{}).Error; err != nil {
+			return err
+		}
+		seen := map[string]bool{}
+		for _, name := range result.Tags {
+			name = strings.TrimSpace(name)
+			if name == "" || len(name) > 100 || seen[name] {
+				continue
+			}
+			seen[name] = true
+			if err := tx.Create(&models.AssetTag{AssetID: assetID, Source: source, Name: name}).Error; err != nil {
+				return err
+			}
+		}
+		for name, raw := range result.Metadata {
+			if name == "" || len(name) > 100 {
+				continue
+			}
+			// Strings are stored without the quotes, anything else as JSON
+			value := ""
+			if json.Unmarshal(raw, &value) != nil {
+				value = string(raw)
+			}
+			value = utils.TruncateString(value, 1024)
+			if err := tx.Create(&models.AssetMetadata{AssetID: assetID, Source: source, Name: name, Value: value}).Error; err != nil {
+				return err
+			}
+		}
+		return touchAsset(tx, assetID)
+	})
+}
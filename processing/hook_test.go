@@ -0,0 +1,75 @@
+package processing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"server/models"
+	"testing"
+)
+
+func Test_parseHookResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		wantTags int
+		wantMeta string
+		wantErr  bool
+	}{
+		{"empty", "  \n", 0, "", false},
+		{"tags", `{"tags": ["nsfw", "cat"]}`, 2, "", false},
+		{"string metadata", `{"metadata": {"score": "high"}}`, 0, `"high"`, false},
+		{"number metadata", `{"metadata": {"score": 0.93}}`, 0, "0.93", false},
+		{"invalid", "not json", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHookResult([]byte(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHookResult() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(got.Tags) != tt.wantTags {
+				t.Errorf("parseHookResult() tags = %v, want %d", got.Tags, tt.wantTags)
+			}
+			if meta := string(got.Metadata["score"]); meta != tt.wantMeta {
+				t.Errorf("parseHookResult() metadata = %v, want %v", meta, tt.wantMeta)
+			}
+		})
+	}
+}
+
+func Test_callWebhookMultipart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte("video data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		if string(data) != "video data" || r.FormValue("asset") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"tags": ["ok"]}`)
+	}))
+	defer server.Close()
+
+	h := &hook{models.ProcessingHook{Type: models.ProcessingHookWebhook, Target: server.URL}}
+	output, err := h.callWebhook(context.Background(), &hookAsset{ID: 1, Name: "video.mp4"}, path)
+	if err != nil {
+		t.Fatalf("callWebhook() error = %v", err)
+	}
+	if string(output) != `{"tags": ["ok"]}` {
+		t.Errorf("callWebhook() = %s", output)
+	}
+}
@@ -0,0 +1,54 @@
+package processing
+
+import (
+	"log"
+	"server/classifier"
+	"server/db"
+	"server/models"
+	"server/storage"
+
+	"gorm.io/gorm"
+)
+
+// imagelabels adds semantic labels to images (using the thumbnail) with the configured classifier
+type imagelabels struct{}
+
+func (t *imagelabels) shouldHandle(asset *models.Asset) bool {
+	return asset.IsImage() && asset.ThumbSize > 0 && asset.ThumbPath != ""
+}
+
+func (t *imagelabels) requiresContent(asset *models.Asset) bool {
+	return true
+}
+
+func (t *imagelabels) process(asset *models.Asset, storage storage.StorageAPI) (status int, clean func()) {
+	if storage.GetSize(asset.ThumbPath) <= 0 {
+		if storage.EnsureLocalFile(asset.ThumbPath) != nil {
+			return Failed, nil
+		}
+	}
+	clean = func() {
+		storage.ReleaseLocalFile(asset.ThumbPath)
+	}
+	labels, err := classifier.Classify(storage.GetFullPath(asset.ThumbPath))
+	if err != nil {
+		log.Printf("Error classifying asset %d, path:%s: %v", asset.ID, asset.ThumbPath, err)
+		return Failed, clean
+	}
+	err = db.Instance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("asset_id = ?", asset.ID).Delete(&models.AssetLabel{}).Error; err != nil {
+			return err
+		}
+		for _, l := range labels {
+			if err := tx.Create(&models.AssetLabel{AssetID: asset.ID, Name: l.Name, Confidence: l.Confidence}).Error; err != nil {
+				return err
+			}
+		}
+		return touchAsset(tx, asset.ID)
+	})
+	if err != nil {
+		log.Printf("Error saving labels for asset ID %d: %v", asset.ID, err)
+		return FailedDB, clean
+	}
+	return Done, clean
+}
@@ -2,7 +2,6 @@ package processing
 
 import (
 	"log"
-	"server/config"
 	"server/db"
 	"server/locations"
 	"server/models"
@@ -34,24 +33,17 @@ func (l *location) process(asset *models.Asset, storage storage.StorageAPI) (int
 			return Done, nil
 		}
 	}
-	var nominatim *locations.NominatimLocation
-	if config.GAODE_API_KEY != "" {
-		// Try Gaode Maps API
-		nominatim = locations.GetGaodeLocation(location.GpsLat, location.GpsLong, config.GAODE_API_KEY)
-	} else {
-		// Try a Nominatim request
-		nominatim = locations.GetNominatimLocation(location.GpsLat, location.GpsLong)
-	}
-	if nominatim == nil {
+	geocoded := locations.Reverse(location.GpsLat, location.GpsLong)
+	if geocoded == nil {
 		log.Printf("No location found for: %d, %f, %f", asset.ID, location.GpsLat, location.GpsLong)
 		return Failed, nil
 	}
 	// Create local DB record
-	location.Display = nominatim.DisplayName
-	location.Area = nominatim.GetArea()
-	location.City = nominatim.GetCity()
-	location.Country = nominatim.Address.Country
-	location.CountryCode = nominatim.Address.CountryCode
+	location.Display = geocoded.Display
+	location.Area = geocoded.Area
+	location.City = geocoded.City
+	location.Country = geocoded.Country
+	location.CountryCode = geocoded.CountryCode
 	res := db.Instance.Create(&location)
 	if res.Error != nil {
 		log.Printf("DB error: %+v", res.Error)
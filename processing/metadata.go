@@ -30,19 +30,23 @@ func (md *metadata) requiresContent(asset *models.Asset) bool {
 }
 
 func (md *metadata) process(asset *models.Asset, storage storage.StorageAPI) (int, func()) {
-	cmd := exec.Command("exiftool", "-n", "-T", "-gpslatitude", "-gpslongitude", "-imagewidth", "-imageheight", "-duration", "-createdate", "-offsettime", storage.GetFullPath(asset.Path))
+	cmd := exec.Command("exiftool", "-n", "-T", "-gpslatitude", "-gpslongitude", "-imagewidth", "-imageheight", "-duration", "-createdate", "-offsettime",
+		"-make", "-model", "-lensmodel", "-focallength", "-iso", "-fnumber", "-exposuretime", storage.GetFullPath(asset.Path))
 	output, err := cmd.Output()
 	if err != nil {
 		log.Printf("Metadata processing error: %v; output: %s", err, output)
 		return Failed, nil
 	}
 	result := strings.Split(strings.Trim(string(output), "\n\t\r "), "\t")
-	if len(result) == 7 {
-		if result[0] != "-" {
-			asset.GpsLat = utils.StringToFloat64Ptr(result[0])
-		}
-		if result[1] != "-" {
-			asset.GpsLong = utils.StringToFloat64Ptr(result[1])
+	if len(result) == 14 {
+		if asset.GpsSource == models.MetadataSourceFile {
+			// Keep locations set by the user
+			if result[0] != "-" {
+				asset.GpsLat = utils.StringToFloat64Ptr(result[0])
+			}
+			if result[1] != "-" {
+				asset.GpsLong = utils.StringToFloat64Ptr(result[1])
+			}
 		}
 		if result[2] != "-" {
 			asset.Width = utils.StringToUInt16(result[2])
@@ -50,30 +54,51 @@ func (md *metadata) process(asset *models.Asset, storage storage.StorageAPI) (in
 		if result[3] != "-" {
 			asset.Height = utils.StringToUInt16(result[3])
 		}
+		orientation := fileOrientation(asset, storage)
+		if asset.IsRaw() {
+			orientation = rawOrientation(storage.GetFullPath(asset.Path))
+		}
+		if orientation >= utils.OrientationTranspose {
+			// Store the dimensions as displayed
+			asset.Width, asset.Height = asset.Height, asset.Width
+		}
 		if result[4] != "-" {
 			d := utils.StringToFloat64Ptr(result[4])
 			asset.Duration = uint32(math.Ceil(*d))
 		}
-		if result[6] != "-" {
-			asset.TimeOffset = getTimeOffsetFrom(result[6])
-		}
-		// Still not having the time offset, but we have the GPS coordinates?
-		if asset.TimeOffset == nil && asset.GpsLat != nil && asset.GpsLong != nil {
-			zone, err := time.LoadLocation(timezonemapper.LatLngToTimezoneString(*asset.GpsLat, *asset.GpsLong))
-			if err == nil && zone != nil {
-				_, offset := time.Now().In(zone).Zone()
-				asset.TimeOffset = &offset
+		if asset.TimeSource == models.MetadataSourceFile {
+			// Keep times corrected by the user
+			if result[6] != "-" {
+				asset.TimeOffset = getTimeOffsetFrom(result[6])
 			}
-		}
-		if result[5] != "-" {
-			if t, err := time.Parse("2006:01:02 15:04:05", result[5]); err == nil {
-				asset.CreatedAt = t.Unix()
-				if asset.TimeOffset != nil {
-					asset.CreatedAt -= int64(*asset.TimeOffset)
+			// Still not having the time offset, but we have the GPS coordinates?
+			if asset.TimeOffset == nil && asset.GpsLat != nil && asset.GpsLong != nil {
+				zone, err := time.LoadLocation(timezonemapper.LatLngToTimezoneString(*asset.GpsLat, *asset.GpsLong))
+				if err == nil && zone != nil {
+					_, offset := time.Now().In(zone).Zone()
+					asset.TimeOffset = &offset
+				}
+			}
+			if result[5] != "-" {
+				if t, err := time.Parse("2006:01:02 15:04:05", result[5]); err == nil {
+					asset.CreatedAt = t.Unix()
+					if asset.TimeOffset != nil {
+						asset.CreatedAt -= int64(*asset.TimeOffset)
+					}
 				}
 			}
 		}
 	}
+	// EXIF first, saving the asset then bumps updated_at for the camera tags as well
+	if len(result) == 14 {
+		if exif := getExifFrom(result[7:]); exif != nil {
+			exif.AssetID = asset.ID
+			if err = db.Instance.Save(exif).Error; err != nil {
+				log.Printf("Error saving EXIF for asset ID %d: %v", asset.ID, err)
+				return FailedDB, nil
+			}
+		}
+	}
 	if err = db.Instance.Save(&asset).Error; err != nil {
 		log.Printf("Error updating DB for asset ID %d: %v", asset.ID, err)
 		return FailedDB, nil
@@ -81,6 +106,32 @@ func (md *metadata) process(asset *models.Asset, storage storage.StorageAPI) (in
 	return Done, nil
 }
 
+// getExifFrom parses camera and exposure values (make, model, lens, focal length, ISO, aperture and shutter speed)
+// as returned by exiftool, or returns nil if none of them is present
+func getExifFrom(values []string) *models.AssetExif {
+	found := false
+	for i, v := range values {
+		if v == "-" {
+			values[i] = ""
+		} else {
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	result := &models.AssetExif{
+		Make:      strings.TrimSpace(values[0]),
+		Model:     strings.TrimSpace(values[1]),
+		LensModel: strings.TrimSpace(values[2]),
+	}
+	result.FocalLength, _ = strconv.ParseFloat(values[3], 64)
+	result.ISO, _ = strconv.Atoi(values[4])
+	result.FNumber, _ = strconv.ParseFloat(values[5], 64)
+	result.ExposureTime, _ = strconv.ParseFloat(values[6], 64)
+	return result
+}
+
 // getTimeOffsetFrom return offset in seconds (or nil on error), input format is "+09:00"
 func getTimeOffsetFrom(s string) *int {
 	parts := strings.SplitN(s, ":", 2)
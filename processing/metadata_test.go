@@ -51,3 +51,18 @@ func Test_getTimeOffsetFrom(t *testing.T) {
 		})
 	}
 }
+
+func Test_getExifFrom(t *testing.T) {
+	if got := getExifFrom([]string{"-", "-", "-", "-", "-", "-", "-"}); got != nil {
+		t.Errorf("getExifFrom() = %+v, want nil", got)
+	}
+	got := getExifFrom([]string{"Canon", "Canon EOS R5", "RF24-70mm F2.8 L IS USM", "50", "400", "2.8", "0.004"})
+	if got == nil {
+		t.Fatal("getExifFrom() = nil")
+	}
+	if got.GetCamera() != "Canon EOS R5" || got.GetFocalLength() != "50mm" || got.GetISO() != "ISO 400" ||
+		got.GetAperture() != "f/2.8" || got.GetShutterSpeed() != "1/250" {
+
+		t.Errorf("getExifFrom() = %+v", got)
+	}
+}
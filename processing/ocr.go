@@ -0,0 +1,67 @@
+package processing
+
+import (
+	"context"
+	"log"
+	"os/exec"
+	"server/config"
+	"server/db"
+	"server/models"
+	"server/storage"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	ocrTimeout = 2 * time.Minute
+)
+
+// ocr extracts text from images (using the thumbnail) with tesseract
+type ocr struct{}
+
+func (t *ocr) shouldHandle(asset *models.Asset) bool {
+	return asset.IsImage() && asset.ThumbSize > 0 && asset.ThumbPath != ""
+}
+
+func (t *ocr) requiresContent(asset *models.Asset) bool {
+	return true
+}
+
+func (t *ocr) process(asset *models.Asset, storage storage.StorageAPI) (status int, clean func()) {
+	if storage.GetSize(asset.ThumbPath) <= 0 {
+		if storage.EnsureLocalFile(asset.ThumbPath) != nil {
+			return Failed, nil
+		}
+	}
+	clean = func() {
+		storage.ReleaseLocalFile(asset.ThumbPath)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ocrTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "tesseract", storage.GetFullPath(asset.ThumbPath), "stdout", "-l", config.OCR_LANGUAGES)
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("OCR error for asset %d, path:%s: %v", asset.ID, asset.ThumbPath, err)
+		return Failed, clean
+	}
+	text := cleanupOCRText(string(output))
+	if err = db.Instance.Save(&models.AssetText{AssetID: asset.ID, Text: text}).Error; err != nil {
+		log.Printf("Error saving text for asset ID %d: %v", asset.ID, err)
+		return FailedDB, clean
+	}
+	return Done, clean
+}
+
+// cleanupOCRText collapses whitespace and drops lines without any letters or digits (usually noise)
+func cleanupOCRText(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if strings.IndexFunc(line, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
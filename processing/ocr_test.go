@@ -0,0 +1,24 @@
+package processing
+
+import "testing"
+
+func Test_cleanupOCRText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", ""},
+		{"whitespace", "  Hello \t  world  \n", "Hello world"},
+		{"noise lines", "Receipt\n| -- |\n  ~~  \nTotal 12.50\n\n", "Receipt\nTotal 12.50"},
+		{"digits only", "2024\n...", "2024"},
+		{"unicode", "Straße  Ünter\n—", "Straße Ünter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanupOCRText(tt.text); got != tt.want {
+				t.Errorf("cleanupOCRText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
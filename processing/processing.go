@@ -4,10 +4,14 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"server/classifier"
+	"server/config"
 	"server/db"
 	"server/models"
 	"server/storage"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type processingTask interface {
@@ -29,7 +33,10 @@ type pendingTask struct {
 
 type processingTasks []processingTasksElement
 
-var tasks = processingTasks{}
+var (
+	tasks        = processingTasks{}
+	builtinTasks = 0 // Number of built-in tasks, the external hooks follow them
+)
 
 func Init() {
 	if err := db.Instance.AutoMigrate(&ProcessingTask{}); err != nil {
@@ -39,17 +46,68 @@ func Init() {
 	tasks.register(&location{})
 	tasks.register(&videoConvert{})
 	tasks.register(&metadata{})
+	tasks.register(&rawpreview{})
 	tasks.register(&thumb{})
 	tasks.register(&detectfaces{})
+	tasks.register(&quality{})
+	tasks.register(&classify{})
+	switch config.METADATA_WRITEBACK {
+	case WritebackOriginal, WritebackSidecar, "":
+	default:
+		log.Printf("Unknown METADATA_WRITEBACK value: %s", config.METADATA_WRITEBACK)
+	}
+	// Optional tasks are only registered when enabled, so existing assets are processed once they're turned on
+	optional := []struct {
+		enabled bool
+		task    processingTask
+	}{
+		{config.OCR_ENABLED, &ocr{}},
+		{classifier.Default != nil, &imagelabels{}},
+		{config.RAW_JPEG_PAIRING, &rawpair{}},
+		{config.METADATA_WRITEBACK == WritebackOriginal || config.METADATA_WRITEBACK == WritebackSidecar, &writeback{}},
+	}
+	for _, o := range optional {
+		if o.enabled {
+			tasks.register(o.task)
+			continue
+		}
+		// Statuses of disabled tasks would be counted as done work for the registered ones.
+		// They're only left after the task was enabled before, usually there's nothing to update
+		name := reflect.TypeOf(o.task).Elem().Name()
+		if !taskRecorded(name) {
+			continue
+		}
+		if err := ForgetTask(name); err != nil {
+			log.Printf("Error forgetting disabled task: %v", err)
+		}
+	}
+	builtinTasks = len(tasks)
 }
 
 func (ts *processingTasks) register(t processingTask) {
+	ts.registerNamed(reflect.TypeOf(t).Elem().Name(), t)
+}
+
+func (ts *processingTasks) registerNamed(name string, t processingTask) {
 	*ts = append(*ts, processingTasksElement{
-		name: reflect.TypeOf(t).Elem().Name(),
+		name: name,
 		task: t,
 	})
 }
 
+// reloadHooks replaces the external hooks with the currently enabled ones
+func (ts *processingTasks) reloadHooks() {
+	hooks := []models.ProcessingHook{}
+	if err := db.Instance.Where("enabled = ?", true).Order("id").Find(&hooks).Error; err != nil {
+		log.Printf("Error loading processing hooks: %v", err)
+		return
+	}
+	*ts = (*ts)[:builtinTasks]
+	for _, h := range hooks {
+		ts.registerNamed(h.TaskName(), &hook{h})
+	}
+}
+
 func (ts *processingTasks) requireContent(asset *models.Asset) bool {
 	for _, e := range *ts {
 		if e.task.requiresContent(asset) && e.task.shouldHandle(asset) {
@@ -96,7 +154,13 @@ func (ts *processingTasks) process(asset *models.Asset, assetStorage storage.Sto
 }
 
 // TODO: 2 or more in parallel? Depending on CPU count?
+// touchAsset bumps updated_at of the asset after its tags or labels changed, as clients use it to reload the lists (e.g. TagList)
+func touchAsset(tx *gorm.DB, assetID uint64) error {
+	return tx.Model(&models.Asset{}).Where("id = ?", assetID).UpdateColumn("updated_at", time.Now().Unix()).Error
+}
+
 func processPending() {
+	tasks.reloadHooks()
 	// All assets that don't hvave processing_tasks record, OR
 	// status has fewer tasks performed than the currently available ones
 	rows, err := db.Instance.
@@ -135,7 +199,7 @@ func processPending() {
 		asset := models.Asset{
 			ID: task.assetID,
 		}
-		if err = db.Instance.Preload("Bucket").Preload("User").First(&asset).Error; err != nil {
+		if err = db.Instance.Preload("Bucket").Preload("User.VideoProfile").First(&asset).Error; err != nil {
 			log.Printf("processPending load asset error: %v, asset: %d", err, asset.ID)
 			break
 		}
@@ -176,8 +240,13 @@ func processPending() {
 }
 
 func StartProcessing() {
+	// Decoding all old thumbnails can take a while, new uploads are processed meanwhile
+	go backfillPlaceholders()
 	for {
 		processPending()
+		if config.FACE_DETECT && time.Since(lastFaceClustering) > faceClusterInterval {
+			clusterFaces()
+		}
 		time.Sleep(10 * time.Second)
 	}
 }
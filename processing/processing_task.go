@@ -2,6 +2,7 @@ package processing
 
 import (
 	"log"
+	"server/db"
 	"server/models"
 	"strconv"
 	"strings"
@@ -14,6 +15,8 @@ const (
 	Failed        = 3
 	FailedStorage = 4
 	FailedDB      = 5
+
+	resetBatchSize = 500 // SQLite has a limit of 999 variables
 )
 
 var (
@@ -57,3 +60,53 @@ func (pt *ProcessingTask) updateWith(statusMap map[string]int) {
 	}
 	pt.Status = strings.Join(result, ",")
 }
+
+// ResetTasks clears the status of the given tasks for the given assets, so they are processed again
+func ResetTasks(assetIDs []uint64, names ...string) error {
+	for start := 0; start < len(assetIDs); start += resetBatchSize {
+		end := min(start+resetBatchSize, len(assetIDs))
+		records := []ProcessingTask{}
+		if err := db.Instance.Where("asset_id IN (?)", assetIDs[start:end]).Find(&records).Error; err != nil {
+			return err
+		}
+		for _, record := range records {
+			statusMap := record.statusToMap()
+			for _, name := range names {
+				delete(statusMap, name)
+			}
+			record.updateWith(statusMap)
+			if err := db.Instance.Model(&record).Update("status", record.Status).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// taskRecorded returns true if any asset has a status of the given task
+func taskRecorded(name string) bool {
+	found := 0
+	db.Instance.Model(&ProcessingTask{}).Select("1").Where("status like ?", "%"+name+":%").Limit(1).Scan(&found)
+	return found > 0
+}
+
+// ForgetTask removes the status of the given task from all assets, e.g. when an external hook is removed.
+// Otherwise the leftover statuses would count towards the tasks performed and hide newly added ones
+func ForgetTask(name string) error {
+	records := []ProcessingTask{}
+	if err := db.Instance.Where("status like ?", "%"+name+":%").Find(&records).Error; err != nil {
+		return err
+	}
+	for _, record := range records {
+		statusMap := record.statusToMap()
+		if _, ok := statusMap[name]; !ok {
+			continue
+		}
+		delete(statusMap, name)
+		record.updateWith(statusMap)
+		if err := db.Instance.Model(&record).Update("status", record.Status).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package processing
+
+import (
+	"image"
+	"log"
+	"math"
+	"os"
+	"server/db"
+	"server/models"
+	"server/storage"
+	"server/utils"
+)
+
+const (
+	sharpnessHalfPoint = 200.0 // Laplacian variance at which the sharpness score is 0.5
+	clippedLow         = 5     // Luminance values at or below are considered underexposed
+	clippedHigh        = 250   // Luminance values at or above are considered overexposed
+	noFacesScore       = 0.4   // Face score used for assets without faces
+)
+
+type quality struct{}
+
+type grayImage struct {
+	width  int
+	height int
+	pix    []float64
+}
+
+func (t *quality) shouldHandle(asset *models.Asset) bool {
+	return asset.ThumbSize > 0 && asset.ThumbPath != ""
+}
+
+func (t *quality) requiresContent(asset *models.Asset) bool {
+	return true
+}
+
+func (t *quality) process(asset *models.Asset, storage storage.StorageAPI) (status int, clean func()) {
+	if storage.GetSize(asset.ThumbPath) <= 0 {
+		if storage.EnsureLocalFile(asset.ThumbPath) != nil {
+			return Failed, nil
+		}
+	}
+	clean = func() {
+		storage.ReleaseLocalFile(asset.ThumbPath)
+	}
+	file, err := os.Open(storage.GetFullPath(asset.ThumbPath))
+	if err != nil {
+		log.Printf("Error opening thumbnail for asset %d, path:%s: %v", asset.ID, asset.ThumbPath, err)
+		return Failed, clean
+	}
+	img, _, err := utils.DecodeImage(file)
+	file.Close()
+	if err != nil {
+		log.Printf("Error decoding thumbnail for asset %d, path:%s: %v", asset.ID, asset.ThumbPath, err)
+		return Failed, clean
+	}
+	// Face boxes were detected on the same thumbnail
+	faces := []image.Rectangle{}
+	rows, err := db.Instance.Raw("select x1, y1, x2, y2 from faces where asset_id=?", asset.ID).Rows()
+	if err != nil {
+		return FailedDB, clean
+	}
+	for rows.Next() {
+		r := image.Rectangle{}
+		if err = rows.Scan(&r.Min.X, &r.Min.Y, &r.Max.X, &r.Max.Y); err != nil {
+			rows.Close()
+			return FailedDB, clean
+		}
+		faces = append(faces, r)
+	}
+	rows.Close()
+
+	result := computeQuality(img, faces)
+	result.AssetID = asset.ID
+	if err = db.Instance.Save(&result).Error; err != nil {
+		log.Printf("Error saving quality for asset ID %d: %v", asset.ID, err)
+		return FailedDB, clean
+	}
+	return Done, clean
+}
+
+// computeQuality scores sharpness, exposure and the faces (if any) of an image
+func computeQuality(img image.Image, faces []image.Rectangle) (result models.AssetQuality) {
+	gray := toGray(img)
+	result.Sharpness = normalizeSharpness(gray.laplacianVariance(gray.bounds()))
+	result.Exposure = gray.exposure()
+	result.Faces = len(faces)
+	result.FaceScore = noFacesScore
+	if len(faces) > 0 {
+		sum := 0.0
+		for _, f := range faces {
+			// The eyes are roughly in the upper middle band of the face box. Closed or blurry eyes have less detail there
+			eyes := image.Rect(f.Min.X, f.Min.Y+f.Dy()/5, f.Max.X, f.Min.Y+f.Dy()/2)
+			sum += normalizeSharpness(gray.laplacianVariance(eyes))
+		}
+		result.FaceScore = 0.6 + 0.4*sum/float64(len(faces))
+	}
+	result.Score = 0.45*result.Sharpness + 0.3*result.Exposure + 0.25*result.FaceScore
+	return
+}
+
+func normalizeSharpness(variance float64) float64 {
+	return variance / (variance + sharpnessHalfPoint)
+}
+
+func toGray(img image.Image) *grayImage {
+	bounds := img.Bounds()
+	result := &grayImage{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		pix:    make([]float64, bounds.Dx()*bounds.Dy()),
+	}
+	for y := 0; y < result.height; y++ {
+		for x := 0; x < result.width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			result.pix[y*result.width+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+		}
+	}
+	return result
+}
+
+func (g *grayImage) bounds() image.Rectangle {
+	return image.Rect(0, 0, g.width, g.height)
+}
+
+// laplacianVariance returns the variance of the Laplacian (4-neighbour kernel) within the given rectangle
+func (g *grayImage) laplacianVariance(r image.Rectangle) float64 {
+	r = r.Intersect(image.Rect(1, 1, g.width-1, g.height-1))
+	if r.Empty() {
+		return 0
+	}
+	sum, sumSq := 0.0, 0.0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := y*g.width + x
+			l := g.pix[i-1] + g.pix[i+1] + g.pix[i-g.width] + g.pix[i+g.width] - 4*g.pix[i]
+			sum += l
+			sumSq += l * l
+		}
+	}
+	n := float64(r.Dx() * r.Dy())
+	mean := sum / n
+	return sumSq/n - mean*mean
+}
+
+// exposure returns 1 for well exposed images, going down for dark, bright or clipped ones
+func (g *grayImage) exposure() float64 {
+	if len(g.pix) == 0 {
+		return 0
+	}
+	sum, clipped := 0.0, 0
+	for _, v := range g.pix {
+		sum += v
+		if v <= clippedLow || v >= clippedHigh {
+			clipped++
+		}
+	}
+	mean := sum / float64(len(g.pix))
+	result := 1 - math.Abs(mean-128)/128 - 2*float64(clipped)/float64(len(g.pix))
+	return math.Max(0, math.Min(1, result))
+}
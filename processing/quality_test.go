@@ -0,0 +1,44 @@
+package processing
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func newTestImage(fill func(x, y int) uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetGray(x, y, color.Gray{fill(x, y)})
+		}
+	}
+	return img
+}
+
+func Test_computeQuality(t *testing.T) {
+	checkerboard := newTestImage(func(x, y int) uint8 {
+		if (x/2+y/2)%2 == 0 {
+			return 60
+		}
+		return 190
+	})
+	flat := newTestImage(func(x, y int) uint8 { return 128 })
+	dark := newTestImage(func(x, y int) uint8 { return 2 })
+
+	sharp := computeQuality(checkerboard, nil)
+	blurry := computeQuality(flat, nil)
+	if sharp.Sharpness <= blurry.Sharpness || sharp.Score <= blurry.Score {
+		t.Errorf("computeQuality() sharp = %+v, blurry = %+v", sharp, blurry)
+	}
+	if blurry.Exposure != 1 {
+		t.Errorf("computeQuality() exposure = %v, want 1", blurry.Exposure)
+	}
+	if got := computeQuality(dark, nil); got.Exposure != 0 {
+		t.Errorf("computeQuality() dark exposure = %v, want 0", got.Exposure)
+	}
+	withFace := computeQuality(checkerboard, []image.Rectangle{image.Rect(10, 10, 40, 40)})
+	if withFace.Faces != 1 || withFace.FaceScore <= noFacesScore {
+		t.Errorf("computeQuality() with face = %+v", withFace)
+	}
+}
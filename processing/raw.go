@@ -0,0 +1,148 @@
+package processing
+
+import (
+	"bytes"
+	"image"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"server/db"
+	"server/models"
+	"server/storage"
+	"server/utils"
+	"strconv"
+	"strings"
+)
+
+const (
+	rawPairMaxTimeDiff = 2 // Seconds between a RAW file and its JPEG to consider them the same shot
+)
+
+var (
+	// Embedded previews, in order of preference (the first ones are usually full size)
+	rawPreviewTags = []string{"-JpgFromRaw", "-PreviewImage", "-OtherImage", "-ThumbnailImage"}
+)
+
+// rawpreview extracts the embedded JPEG preview of RAW files, which is then used for thumbnails and display
+type rawpreview struct{}
+
+func (t *rawpreview) shouldHandle(asset *models.Asset) bool {
+	return asset.IsRaw() && asset.PreviewPath == ""
+}
+
+func (t *rawpreview) requiresContent(asset *models.Asset) bool {
+	return true
+}
+
+func (t *rawpreview) process(asset *models.Asset, storage storage.StorageAPI) (status int, clean func()) {
+	fullPath := storage.GetFullPath(asset.Path)
+	var preview image.Image
+	for _, tag := range rawPreviewTags {
+		data, err := exec.Command("exiftool", "-b", tag, fullPath).Output()
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		if preview, _, err = image.Decode(bytes.NewReader(data)); err == nil {
+			break
+		}
+	}
+	if preview == nil {
+		log.Printf("No embedded preview found for RAW asset ID %d (%s)", asset.ID, asset.Path)
+		return Failed, nil
+	}
+	// The orientation is set on the RAW file, not on the preview
+	preview = utils.ApplyOrientation(preview, rawOrientation(fullPath))
+	buf := bytes.Buffer{}
+	if err := utils.EncodeJPEG(&buf, preview); err != nil {
+		log.Printf("Error encoding RAW preview for asset ID %d: %v", asset.ID, err)
+		return Failed, nil
+	}
+	previewPath := asset.CreatePreviewPath()
+	if _, err := storage.Save(previewPath, &buf); err != nil {
+		log.Printf("Error saving RAW preview for asset ID %d (%s): %v", asset.ID, previewPath, err)
+		return Failed, nil
+	}
+	// The thumbnail is created from the local preview as well
+	clean = func() {
+		storage.ReleaseLocalFile(previewPath)
+	}
+	if err := storage.UpdateRemoteFile(previewPath, "image/jpeg"); err != nil {
+		log.Printf("Error in storage.UpdateFile for asset ID %d (%s): %v", asset.ID, previewPath, err)
+		return Failed, clean
+	}
+	asset.PreviewPath = previewPath
+	if err := db.Instance.Model(asset).Update("preview_path", previewPath).Error; err != nil {
+		log.Printf("Error saving asset to DB for ID %d: %v", asset.ID, err)
+		return FailedDB, clean
+	}
+	return Done, clean
+}
+
+// rawOrientation returns the EXIF orientation of a RAW file, using exiftool
+func rawOrientation(fullPath string) int {
+	output, err := exec.Command("exiftool", "-n", "-T", "-Orientation", fullPath).Output()
+	if err != nil {
+		return utils.OrientationNormal
+	}
+	o, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil || o < utils.OrientationNormal || o > 8 {
+		return utils.OrientationNormal
+	}
+	return o
+}
+
+// rawpair links RAW files with JPEGs of the same shot, so only the JPEG is listed
+type rawpair struct{}
+
+func (t *rawpair) shouldHandle(asset *models.Asset) bool {
+	return (asset.IsRaw() || asset.MimeType == "image/jpeg") && asset.PairedWithID == nil && asset.GroupID == nil
+}
+
+func (t *rawpair) requiresContent(asset *models.Asset) bool {
+	return false
+}
+
+func (t *rawpair) process(asset *models.Asset, storage storage.StorageAPI) (int, func()) {
+	candidates := []models.Asset{}
+	err := db.Instance.
+		Where("user_id = ? and id <> ? and deleted=0 and group_id is null and paired_with_id is null and created_at between ? and ?",
+			asset.UserID, asset.ID, asset.CreatedAt-rawPairMaxTimeDiff, asset.CreatedAt+rawPairMaxTimeDiff).
+		Where("name like ? "+db.LikeEscape, db.EscapeLike(rawBaseName(asset.Name))+".%").
+		Find(&candidates).Error
+	if err != nil {
+		log.Printf("Error loading RAW pair candidates for asset ID %d: %v", asset.ID, err)
+		return FailedDB, nil
+	}
+	for i := range candidates {
+		raw, jpeg := asset, &candidates[i]
+		if !asset.IsRaw() {
+			raw, jpeg = jpeg, raw
+		}
+		if !isRawJpegPair(raw, jpeg) {
+			continue
+		}
+		if err = db.Instance.Model(raw).Update("paired_with_id", jpeg.ID).Error; err != nil {
+			log.Printf("Error pairing RAW asset ID %d with %d: %v", raw.ID, jpeg.ID, err)
+			return FailedDB, nil
+		}
+		return Done, nil
+	}
+	// Nothing to pair with (yet), the other file will find this one when it's processed
+	return Done, nil
+}
+
+func rawBaseName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// isRawJpegPair checks if the two assets are the RAW and JPEG versions of the same shot
+func isRawJpegPair(raw, jpeg *models.Asset) bool {
+	if !raw.IsRaw() || jpeg.MimeType != "image/jpeg" || raw.UserID != jpeg.UserID {
+		return false
+	}
+	diff := raw.CreatedAt - jpeg.CreatedAt
+	if diff < -rawPairMaxTimeDiff || diff > rawPairMaxTimeDiff {
+		return false
+	}
+	return strings.EqualFold(rawBaseName(raw.Name), rawBaseName(jpeg.Name))
+}
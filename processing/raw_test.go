@@ -0,0 +1,27 @@
+package processing
+
+import (
+	"server/models"
+	"testing"
+)
+
+func TestIsRawJpegPair(t *testing.T) {
+	jpeg := &models.Asset{UserID: 1, Name: "IMG_0001.JPG", MimeType: "image/jpeg", CreatedAt: 1000}
+	tests := []struct {
+		name string
+		raw  models.Asset
+		want bool
+	}{
+		{"same shot", models.Asset{UserID: 1, Name: "IMG_0001.CR2", MimeType: "image/x-canon-cr2", CreatedAt: 1000}, true},
+		{"case and time difference", models.Asset{UserID: 1, Name: "img_0001.dng", MimeType: "image/x-adobe-dng", CreatedAt: 1002}, true},
+		{"too far in time", models.Asset{UserID: 1, Name: "IMG_0001.CR2", MimeType: "image/x-canon-cr2", CreatedAt: 1003}, false},
+		{"different name", models.Asset{UserID: 1, Name: "IMG_0002.CR2", MimeType: "image/x-canon-cr2", CreatedAt: 1000}, false},
+		{"different user", models.Asset{UserID: 2, Name: "IMG_0001.CR2", MimeType: "image/x-canon-cr2", CreatedAt: 1000}, false},
+		{"not RAW", models.Asset{UserID: 1, Name: "IMG_0001.HEIC", MimeType: "image/heic", CreatedAt: 1000}, false},
+	}
+	for _, tt := range tests {
+		if got := isRawJpegPair(&tt.raw, jpeg); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
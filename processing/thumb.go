@@ -4,16 +4,18 @@ import (
 	"bytes"
 	"image"
 	"log"
+	"os"
 	"os/exec"
 	"server/db"
 	"server/models"
 	"server/storage"
+	"server/utils"
 )
 
 type thumb struct{}
 
 func (t *thumb) shouldHandle(asset *models.Asset) bool {
-	return asset.ThumbSize == 0
+	return asset.ThumbSize == 0 && (!asset.IsRaw() || asset.PreviewPath != "")
 }
 
 func (t *thumb) requiresContent(asset *models.Asset) bool {
@@ -22,7 +24,27 @@ func (t *thumb) requiresContent(asset *models.Asset) bool {
 
 func (t *thumb) process(asset *models.Asset, storage storage.StorageAPI) (status int, clean func()) {
 	thumbPath := asset.CreateThumbPath()
-	cmd := exec.Command("ffmpeg", "-y", "-i", storage.GetFullPath(asset.Path), "-vf", "scale=min(1280\\,iw):-1", "-ss", "00:00:00.000", "-vframes", "1", storage.GetFullPath(thumbPath))
+	args := []string{"-y"}
+	orientation := fileOrientation(asset, storage)
+	if orientation != utils.OrientationNormal {
+		// EXIF orientation is applied below, make sure ffmpeg doesn't do that as well
+		args = append(args, "-noautorotate")
+	}
+	source := asset.Path
+	if asset.IsRaw() {
+		// ffmpeg can't decode RAW files, the (upright) embedded preview is used instead
+		source = asset.PreviewPath
+		// The preview is still local if it was just created, then the task creating it releases it
+		if storage.GetSize(source) <= 0 {
+			if err := storage.EnsureLocalFile(source); err != nil {
+				log.Printf("Error loading RAW preview for asset %d, path:%s: %v", asset.ID, source, err)
+				return Failed, nil
+			}
+			defer storage.ReleaseLocalFile(source)
+		}
+	}
+	args = append(args, "-i", storage.GetFullPath(source), "-vf", "scale=min(1280\\,iw):-1", "-ss", "00:00:00.000", "-vframes", "1", storage.GetFullPath(thumbPath))
+	cmd := exec.Command("ffmpeg", args...)
 	err := cmd.Run()
 	if err != nil {
 		log.Printf("Error creating thumbnail for asset %d, path:%s: %s", asset.ID, thumbPath, err.Error())
@@ -44,9 +66,22 @@ func (t *thumb) process(asset *models.Asset, storage storage.StorageAPI) (status
 		log.Printf("Error decoding thumbnail for ID %d (%s): %v", asset.ID, thumbPath, err)
 		return Failed, clean
 	}
+	if orientation != utils.OrientationNormal {
+		// Store the thumbnail upright
+		thumb = utils.ApplyOrientation(thumb, orientation)
+		upright := bytes.Buffer{}
+		if err = utils.EncodeJPEG(&upright, thumb); err == nil {
+			asset.ThumbSize, err = storage.Save(thumbPath, &upright)
+		}
+		if err != nil {
+			log.Printf("Error saving upright thumbnail for ID %d (%s): %v", asset.ID, thumbPath, err)
+			return Failed, clean
+		}
+	}
 	asset.ThumbPath = thumbPath
 	asset.ThumbWidth = uint16(thumb.Bounds().Dx())
 	asset.ThumbHeight = uint16(thumb.Bounds().Dy())
+	asset.SetPlaceholders(thumb)
 	asset.PresignedThumbUntil = 0 // Clear S3 URL cache
 	if err = db.Instance.Save(&asset).Error; err != nil {
 		log.Printf("Error saving asset to DB for ID %d: %v", asset.ID, err)
@@ -61,3 +96,95 @@ func (t *thumb) process(asset *models.Asset, storage storage.StorageAPI) (status
 	}
 	return Done, clean
 }
+
+// backfillPlaceholders calculates BlurHash and dominant colour for assets that had their thumbnails created before that was supported
+func backfillPlaceholders() {
+	lastID := uint64(0)
+	for {
+		assets := []models.Asset{}
+		err := db.Instance.Preload("Bucket").
+			Where("id > ? AND deleted=0 AND thumb_size>0 AND (blur_hash IS NULL OR blur_hash='')", lastID).
+			Order("id").Limit(100).Find(&assets).Error
+		if err != nil {
+			log.Printf("backfillPlaceholders error: %v", err)
+			return
+		}
+		if len(assets) == 0 {
+			return
+		}
+		for _, asset := range assets {
+			lastID = asset.ID
+			storage := storage.StorageFrom(&asset.Bucket)
+			if storage == nil {
+				continue
+			}
+			if storage.GetSize(asset.ThumbPath) <= 0 {
+				if storage.EnsureLocalFile(asset.ThumbPath) != nil {
+					continue
+				}
+			}
+			buf := bytes.Buffer{}
+			_, err = storage.Load(asset.ThumbPath, &buf)
+			storage.ReleaseLocalFile(asset.ThumbPath)
+			if err != nil {
+				continue
+			}
+			thumb, _, err := utils.DecodeImage(&buf)
+			if err != nil {
+				log.Printf("backfillPlaceholders: cannot decode thumbnail for asset ID %d: %v", asset.ID, err)
+				continue
+			}
+			asset.SetPlaceholders(thumb)
+			// Not bumping updated_at, that would invalidate the cached lists of all clients
+			err = db.Instance.Model(&asset).UpdateColumns(models.Asset{BlurHash: asset.BlurHash, DominantColor: asset.DominantColor}).Error
+			if err != nil {
+				log.Printf("backfillPlaceholders: cannot update asset ID %d: %v", asset.ID, err)
+			}
+		}
+	}
+}
+
+// fileOrientation returns the EXIF orientation of JPEG images (HEIF and others are handled by the decoders)
+func fileOrientation(asset *models.Asset, storage storage.StorageAPI) int {
+	if asset.MimeType != "image/jpeg" {
+		return utils.OrientationNormal
+	}
+	file, err := os.Open(storage.GetFullPath(asset.Path))
+	if err != nil {
+		return utils.OrientationNormal
+	}
+	defer file.Close()
+	return utils.ReadOrientation(file)
+}
+
+// ensureUprightThumb re-encodes thumbnails that were uploaded with an EXIF orientation (before it was applied on upload),
+// so that consumers reading the raw pixels (e.g. face detection) get the same image as displayed
+func ensureUprightThumb(asset *models.Asset, storage storage.StorageAPI) error {
+	data, err := os.ReadFile(storage.GetFullPath(asset.ThumbPath))
+	if err != nil {
+		return err
+	}
+	thumb, orientation, err := utils.DecodeImage(bytes.NewReader(data))
+	if err != nil || orientation == utils.OrientationNormal {
+		return err
+	}
+	upright := bytes.Buffer{}
+	if err = utils.EncodeJPEG(&upright, thumb); err != nil {
+		return err
+	}
+	if asset.ThumbSize, err = storage.Save(asset.ThumbPath, &upright); err != nil {
+		return err
+	}
+	if err = storage.UpdateRemoteFile(asset.ThumbPath, "image/jpeg"); err != nil {
+		return err
+	}
+	asset.ThumbWidth = uint16(thumb.Bounds().Dx())
+	asset.ThumbHeight = uint16(thumb.Bounds().Dy())
+	asset.PresignedThumbUntil = 0 // Clear S3 URL cache
+	return db.Instance.Model(asset).Updates(map[string]any{
+		"thumb_size":            asset.ThumbSize,
+		"thumb_width":           asset.ThumbWidth,
+		"thumb_height":          asset.ThumbHeight,
+		"presigned_thumb_until": 0,
+	}).Error
+}
@@ -8,12 +8,30 @@ import (
 	"server/db"
 	"server/models"
 	"server/storage"
+	"strconv"
+	"strings"
+)
+
+const (
+	convertedSuffix = "_converted" // Used when the original file is already an MP4
 )
 
 type videoConvert struct{}
 
 func (vc *videoConvert) shouldHandle(asset *models.Asset) bool {
-	return asset.IsVideo() && asset.MimeType != "video/mp4"
+	if !asset.IsVideo() {
+		return false
+	}
+	if asset.User.VideoProfileID == nil {
+		// The default profile only converts to MP4 (or back from a custom profile)
+		return asset.MimeType != "video/mp4" || asset.VideoProfileID != nil
+	}
+	// Convert if the user's profile is different from the one used last time, or it was changed since.
+	// A changed profile is only applied when the original was kept, converting the converted video again would lose more quality
+	if asset.MimeType != "video/mp4" || asset.VideoProfileID == nil || *asset.VideoProfileID != *asset.User.VideoProfileID {
+		return true
+	}
+	return asset.OriginalPath != "" && asset.User.VideoProfile != nil && asset.VideoProfileVersion != asset.User.VideoProfile.Version
 }
 
 func (vc *videoConvert) requiresContent(asset *models.Asset) bool {
@@ -24,27 +42,64 @@ func (vc *videoConvert) process(asset *models.Asset, storage storage.StorageAPI)
 	if asset.User.VideoSetting == models.VideoSettingSkip {
 		return UserSkipped, nil
 	}
+	profile := models.DefaultVideoProfile
+	if asset.User.VideoProfileID != nil {
+		if err := db.Instance.First(&profile, *asset.User.VideoProfileID).Error; err != nil {
+			log.Printf("Error loading video profile %d for asset ID %d: %v", *asset.User.VideoProfileID, asset.ID, err)
+			return FailedDB, nil
+		}
+	}
 	oldPath := asset.Path
-	ext := filepath.Ext(asset.Name)
+	// Re-transcode from the original, if we kept it
+	srcPath := asset.Path
+	if asset.OriginalPath != "" {
+		srcPath = asset.OriginalPath
+		if err := storage.EnsureLocalFile(srcPath); err != nil {
+			log.Printf("Error downloading original video for asset ID %d (%s): %v", asset.ID, srcPath, err)
+			return FailedStorage, nil
+		}
+	}
+	ext := filepath.Ext(srcPath)
+	base := strings.TrimSuffix(srcPath[:len(srcPath)-len(ext)], convertedSuffix)
+	asset.Path = base + ".mp4"
+	if asset.Path == srcPath {
+		asset.Path = base + convertedSuffix + ".mp4"
+	}
+	ext = filepath.Ext(asset.Name)
 	asset.Name = asset.Name[:len(asset.Name)-len(ext)] + ".mp4"
-	asset.Path = asset.Path[:len(asset.Path)-len(ext)] + ".mp4"
-	err := ffmpegConvert(storage.GetFullPath(oldPath), storage.GetFullPath(asset.Path))
+	err := ffmpegConvert(storage.GetFullPath(srcPath), storage.GetFullPath(asset.Path), &profile)
 	asset.Size = storage.GetSize(asset.Path)
 	// Always cleanup in the end
 	clean = func() {
 		// Delete the temp file after all tasks have completed
 		storage.ReleaseLocalFile(asset.Path)
+		if srcPath != oldPath {
+			storage.ReleaseLocalFile(srcPath)
+		}
 	}
 	if err != nil || asset.Size <= 0 {
-		fmt.Printf("ERROR in video processing for: %s, %v, size: %v\n", oldPath, err, asset.Size)
+		fmt.Printf("ERROR in video processing for: %s, %v, size: %v\n", srcPath, err, asset.Size)
 		return Failed, clean
 	}
 	log.Print("DONE video processing for:", asset.Path)
 
 	asset.MimeType = "video/mp4"
 	asset.PresignedUntil = 0
+	asset.VideoProfileID = asset.User.VideoProfileID
+	asset.VideoProfileVersion = profile.Version
+	toDelete := []string{}
+	if profile.KeepOriginal {
+		asset.OriginalPath = srcPath
+	} else {
+		asset.OriginalPath = ""
+		toDelete = append(toDelete, srcPath)
+	}
+	if oldPath != srcPath && oldPath != asset.Path {
+		// Previous conversion
+		toDelete = append(toDelete, oldPath)
+	}
 	if err := storage.UpdateRemoteFile(asset.Path, asset.MimeType); err != nil {
-		log.Printf("Error updating asset ID %d (%s->%s): %v", asset.ID, oldPath, asset.Path, err)
+		log.Printf("Error updating asset ID %d (%s->%s): %v", asset.ID, srcPath, asset.Path, err)
 		return Failed, clean
 	}
 	if err = db.Instance.Save(&asset).Error; err != nil {
@@ -52,17 +107,38 @@ func (vc *videoConvert) process(asset *models.Asset, storage storage.StorageAPI)
 		return Failed, clean
 	}
 	// Delete old files and objects
-	err1 := storage.DeleteRemoteFile(oldPath)
-	err2 := storage.Delete(oldPath)
-	if err1 != nil || err2 != nil {
-		log.Printf("Error deleting old objects for asset ID %d (%s), errors (remote,local): %v, %v", asset.ID, oldPath, err1, err2)
+	for _, path := range toDelete {
+		err1 := storage.DeleteRemoteFile(path)
+		err2 := storage.Delete(path)
+		if err1 != nil || err2 != nil {
+			log.Printf("Error deleting old objects for asset ID %d (%s), errors (remote,local): %v, %v", asset.ID, path, err1, err2)
+		}
 	}
 	return Done, clean
 }
 
-// ffmpegConvert uses hard-coded options
-func ffmpegConvert(inFile, outFile string) error {
-	log.Printf("Converting file %s to %s", inFile, outFile)
-	cmd := exec.Command("ffmpeg", "-y", "-i", inFile, "-c:v", "libx264", "-c:a", "aac", "-b:a", "128k", "-crf", "24", "-movflags", "use_metadata_tags", "-map_metadata", "0", outFile)
+// ffmpegConvert uses the options from the given profile
+func ffmpegConvert(inFile, outFile string, profile *models.VideoProfile) error {
+	log.Printf("Converting file %s to %s (profile: %s)", inFile, outFile, profile.Name)
+	cmd := exec.Command("ffmpeg", ffmpegArgs(inFile, outFile, profile)...)
 	return cmd.Run()
 }
+
+func ffmpegArgs(inFile, outFile string, profile *models.VideoProfile) []string {
+	args := []string{"-y", "-i", inFile}
+	if profile.MaxResolution > 0 {
+		// Limit the shorter side, keeping the aspect ratio
+		r := profile.MaxResolution
+		args = append(args, "-vf", fmt.Sprintf("scale=if(gt(iw\\,ih)\\,-2\\,min(%d\\,iw)):if(gt(iw\\,ih)\\,min(%d\\,ih)\\,-2)", r, r))
+	}
+	switch profile.Codec {
+	case models.VideoCodecHEVC:
+		args = append(args, "-c:v", "libx265", "-tag:v", "hvc1")
+	case models.VideoCodecAV1:
+		args = append(args, "-c:v", "libsvtav1")
+	default:
+		args = append(args, "-c:v", "libx264")
+	}
+	return append(args, "-c:a", "aac", "-b:a", strconv.Itoa(int(profile.AudioBitrate))+"k", "-crf", strconv.Itoa(int(profile.CRF)),
+		"-movflags", "use_metadata_tags", "-map_metadata", "0", outFile)
+}
@@ -0,0 +1,196 @@
+package processing
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"server/config"
+	"server/db"
+	"server/models"
+	"server/storage"
+	"time"
+)
+
+const (
+	WritebackOriginal = "original" // Write into the original files (where supported, sidecars are used for the rest)
+	WritebackSidecar  = "sidecar"  // Write XMP sidecar files next to the originals
+
+	writebackTask   = "writeback"
+	writebackRating = "5" // Favourites are written as 5 star rating
+)
+
+// writeback writes corrected metadata (date/time, GPS, caption, people and favourite) back to the original or an XMP sidecar
+type writeback struct{}
+
+// writebackInfo is the metadata written back for an asset
+type writebackInfo struct {
+	created    int64 // Local time, as unix timestamp
+	timeOffset *int  // In seconds, nil if unknown
+	gpsLat     *float64
+	gpsLong    *float64
+	caption    string
+	people     []string
+	favourite  bool
+}
+
+// RequestWriteback marks the assets so their metadata is written back (if enabled) the next time they are processed
+func RequestWriteback(assetIDs []uint64) error {
+	if config.METADATA_WRITEBACK == "" || len(assetIDs) == 0 {
+		return nil
+	}
+	for start := 0; start < len(assetIDs); start += resetBatchSize {
+		end := min(start+resetBatchSize, len(assetIDs))
+		if err := db.Instance.Model(&models.Asset{}).Where("id IN (?)", assetIDs[start:end]).Update("writeback_pending", true).Error; err != nil {
+			return err
+		}
+	}
+	return ResetTasks(assetIDs, writebackTask)
+}
+
+func (t *writeback) shouldHandle(asset *models.Asset) bool {
+	return asset.WritebackPending && asset.GroupID == nil
+}
+
+func (t *writeback) requiresContent(asset *models.Asset) bool {
+	return true
+}
+
+func (t *writeback) process(asset *models.Asset, storage storage.StorageAPI) (status int, clean func()) {
+	info := writebackInfo{
+		created:    asset.CreatedAt,
+		timeOffset: asset.TimeOffset,
+		gpsLat:     asset.GpsLat,
+		gpsLong:    asset.GpsLong,
+		caption:    asset.Caption,
+	}
+	if asset.TimeOffset != nil {
+		info.created += int64(*asset.TimeOffset)
+	}
+	err := db.Instance.Model(&models.Face{}).
+		Joins("join people on people.id = faces.person_id").
+		Where("faces.asset_id = ?", asset.ID).
+		Distinct().Order("people.name").Pluck("people.name", &info.people).Error
+	if err != nil {
+		return FailedDB, nil
+	}
+	var favourites int64
+	if err = db.Instance.Model(&models.FavouriteAsset{}).Where("asset_id = ? and user_id = ?", asset.ID, asset.UserID).Count(&favourites).Error; err != nil {
+		return FailedDB, nil
+	}
+	info.favourite = favourites > 0
+
+	if config.METADATA_WRITEBACK == WritebackOriginal && canWriteOriginal(asset) {
+		args := append([]string{"-overwrite_original", "-m"}, writebackArgs(&info, false)...)
+		cmd := exec.Command("exiftool", append(args, storage.GetFullPath(asset.Path))...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			log.Printf("Metadata write-back error for asset ID %d: %v; output: %s", asset.ID, err, output)
+			return Failed, nil
+		}
+		if err = storage.UpdateRemoteFile(asset.Path, asset.MimeType); err != nil {
+			log.Printf("Error in storage.UpdateFile for asset ID %d (%s): %v", asset.ID, asset.Path, err)
+			return Failed, nil
+		}
+		asset.Size = storage.GetSize(asset.Path)
+	} else {
+		sidecarPath := asset.SidecarPath()
+		// exiftool doesn't overwrite existing files when creating new ones
+		_ = storage.Delete(sidecarPath)
+		args := append([]string{"-m", "-o", storage.GetFullPath(sidecarPath)}, writebackArgs(&info, true)...)
+		cmd := exec.Command("exiftool", append(args, storage.GetFullPath(asset.Path))...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			log.Printf("XMP sidecar error for asset ID %d: %v; output: %s", asset.ID, err, output)
+			return Failed, nil
+		}
+		clean = func() {
+			storage.ReleaseLocalFile(sidecarPath)
+		}
+		if err = storage.UpdateRemoteFile(sidecarPath, "application/rdf+xml"); err != nil {
+			log.Printf("Error in storage.UpdateFile for asset ID %d (%s): %v", asset.ID, sidecarPath, err)
+			return Failed, clean
+		}
+	}
+	asset.WritebackPending = false
+	// Not changing updated_at, there is nothing new for the clients
+	if err = db.Instance.Model(asset).UpdateColumns(map[string]any{"writeback_pending": false, "size": asset.Size}).Error; err != nil {
+		log.Printf("Error saving asset to DB for ID %d: %v", asset.ID, err)
+		return FailedDB, clean
+	}
+	return Done, clean
+}
+
+// canWriteOriginal returns true for formats exiftool can safely write to (RAW files and videos get sidecars)
+func canWriteOriginal(asset *models.Asset) bool {
+	switch asset.MimeType {
+	case "image/jpeg", "image/png", "image/heic", "image/heif":
+		return true
+	}
+	return false
+}
+
+// writebackArgs returns the exiftool tag assignments for the original file or an XMP sidecar
+func writebackArgs(info *writebackInfo, sidecar bool) (args []string) {
+	created := time.Unix(info.created, 0).UTC().Format("2006:01:02 15:04:05")
+	offset := ""
+	if info.timeOffset != nil {
+		offset = formatTimeOffset(*info.timeOffset)
+	}
+	if sidecar {
+		args = append(args, "-XMP-exif:DateTimeOriginal="+created+offset, "-XMP-xmp:CreateDate="+created+offset)
+	} else {
+		args = append(args, "-AllDates="+created)
+		if offset != "" {
+			args = append(args, "-OffsetTime="+offset, "-OffsetTimeOriginal="+offset, "-OffsetTimeDigitized="+offset)
+		}
+	}
+
+	lat, latRef, long, longRef := "", "", "", ""
+	if info.gpsLat != nil && info.gpsLong != nil {
+		lat, latRef = formatCoordinate(*info.gpsLat, "N", "S")
+		long, longRef = formatCoordinate(*info.gpsLong, "E", "W")
+	}
+	if sidecar {
+		// XMP coordinates include the reference, empty values remove the tags
+		if lat != "" {
+			lat += " " + latRef
+			long += " " + longRef
+		}
+		args = append(args, "-XMP-exif:GPSLatitude="+lat, "-XMP-exif:GPSLongitude="+long)
+	} else {
+		args = append(args, "-GPSLatitude="+lat, "-GPSLatitudeRef="+latRef, "-GPSLongitude="+long, "-GPSLongitudeRef="+longRef)
+	}
+
+	if !sidecar {
+		args = append(args, "-ImageDescription="+info.caption)
+	}
+	args = append(args, "-XMP-dc:Description="+info.caption)
+	// Empty assignment first, so the list is replaced instead of appended to
+	args = append(args, "-XMP-iptcExt:PersonInImage=")
+	for _, name := range info.people {
+		args = append(args, "-XMP-iptcExt:PersonInImage="+name)
+	}
+	rating := ""
+	if info.favourite {
+		rating = writebackRating
+	}
+	return append(args, "-XMP-xmp:Rating="+rating)
+}
+
+// formatTimeOffset returns the offset in the format used by EXIF, e.g. "+09:00"
+func formatTimeOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, offset/3600, offset%3600/60)
+}
+
+// formatCoordinate returns the absolute value and its reference (e.g. "N" or "S")
+func formatCoordinate(value float64, positive, negative string) (string, string) {
+	ref := positive
+	if value < 0 {
+		ref = negative
+	}
+	return fmt.Sprintf("%.6f", math.Abs(value)), ref
+}
@@ -0,0 +1,67 @@
+package processing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWritebackArgs(t *testing.T) {
+	offset := 9 * 3600
+	lat, long := 35.681236, -139.767125
+	info := writebackInfo{
+		created:    1700000000, // 2023-11-14 22:13:20
+		timeOffset: &offset,
+		gpsLat:     &lat,
+		gpsLong:    &long,
+		caption:    "Tokyo",
+		people:     []string{"Alice", "Bob"},
+		favourite:  true,
+	}
+	tests := []struct {
+		name    string
+		info    writebackInfo
+		sidecar bool
+		want    []string
+	}{
+		{"original", info, false, []string{
+			"-AllDates=2023:11:14 22:13:20", "-OffsetTime=+09:00", "-OffsetTimeOriginal=+09:00", "-OffsetTimeDigitized=+09:00",
+			"-GPSLatitude=35.681236", "-GPSLatitudeRef=N", "-GPSLongitude=139.767125", "-GPSLongitudeRef=W",
+			"-ImageDescription=Tokyo", "-XMP-dc:Description=Tokyo",
+			"-XMP-iptcExt:PersonInImage=", "-XMP-iptcExt:PersonInImage=Alice", "-XMP-iptcExt:PersonInImage=Bob",
+			"-XMP-xmp:Rating=5",
+		}},
+		{"sidecar", info, true, []string{
+			"-XMP-exif:DateTimeOriginal=2023:11:14 22:13:20+09:00", "-XMP-xmp:CreateDate=2023:11:14 22:13:20+09:00",
+			"-XMP-exif:GPSLatitude=35.681236 N", "-XMP-exif:GPSLongitude=139.767125 W",
+			"-XMP-dc:Description=Tokyo",
+			"-XMP-iptcExt:PersonInImage=", "-XMP-iptcExt:PersonInImage=Alice", "-XMP-iptcExt:PersonInImage=Bob",
+			"-XMP-xmp:Rating=5",
+		}},
+		{"cleared values", writebackInfo{created: 1700000000}, false, []string{
+			"-AllDates=2023:11:14 22:13:20",
+			"-GPSLatitude=", "-GPSLatitudeRef=", "-GPSLongitude=", "-GPSLongitudeRef=",
+			"-ImageDescription=", "-XMP-dc:Description=",
+			"-XMP-iptcExt:PersonInImage=",
+			"-XMP-xmp:Rating=",
+		}},
+	}
+	for _, tt := range tests {
+		if got := writebackArgs(&tt.info, tt.sidecar); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTimeOffset(t *testing.T) {
+	tests := map[int]string{
+		0:      "+00:00",
+		32400:  "+09:00",
+		-16200: "-04:30",
+		20700:  "+05:45",
+	}
+	for offset, want := range tests {
+		if got := formatTimeOffset(offset); got != want {
+			t.Errorf("formatTimeOffset(%d) = %s, want %s", offset, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	blurHashChars      = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+	blurHashSampleSize = 32 // Images are downscaled to at most that before encoding
+)
+
+// BlurHash encodes the image as a BlurHash string (see https://blurha.sh) with the given number of components
+func BlurHash(img image.Image, xComponents, yComponents int) string {
+	img = resize.Thumbnail(blurHashSampleSize, blurHashSampleSize, img, resize.Bilinear)
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return ""
+	}
+	// Convert to linear RGB once
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			linear[y*width+x] = [3]float64{sRGBToLinear(r >> 8), sRGBToLinear(g >> 8), sRGBToLinear(b >> 8)}
+		}
+	}
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			factor := [3]float64{}
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					for c := 0; c < 3; c++ {
+						factor[c] += basis * linear[y*width+x][c]
+					}
+				}
+			}
+			scale := 1 / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+	var hash strings.Builder
+	hash.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+	maximumValue := 1.0
+	if len(factors) > 1 {
+		actualMaximumValue := 0.0
+		for _, f := range factors[1:] {
+			actualMaximumValue = math.Max(actualMaximumValue, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMaximumValue := int(math.Max(0, math.Min(82, math.Floor(actualMaximumValue*166-0.5))))
+		maximumValue = float64(quantisedMaximumValue+1) / 166
+		hash.WriteString(encode83(quantisedMaximumValue, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+	dc := factors[0]
+	hash.WriteString(encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, f := range factors[1:] {
+		hash.WriteString(encode83(encodeAC(f, maximumValue), 2))
+	}
+	return hash.String()
+}
+
+// DominantColor returns the most common colour of the image (in a coarse palette) as a "#rrggbb" string
+func DominantColor(img image.Image) string {
+	img = resize.Thumbnail(blurHashSampleSize, blurHashSampleSize, img, resize.Bilinear)
+	bounds := img.Bounds()
+	type bucket struct {
+		count   int
+		r, g, b uint32
+	}
+	buckets := map[uint32]*bucket{}
+	var best *bucket
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			r, g, b = r>>8, g>>8, b>>8
+			// 4 bits per channel
+			key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+			current, ok := buckets[key]
+			if !ok {
+				current = &bucket{}
+				buckets[key] = current
+			}
+			current.count++
+			current.r += r
+			current.g += g
+			current.b += b
+			if best == nil || current.count > best.count {
+				best = current
+			}
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	n := uint32(best.count)
+	return fmt.Sprintf("#%02x%02x%02x", best.r/n, best.g/n, best.b/n)
+}
+
+func encode83(value, length int) string {
+	result := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		result[i-1] = blurHashChars[digit]
+	}
+	return string(result)
+}
+
+func encodeAC(value [3]float64, maximumValue float64) int {
+	quant := func(v float64) int {
+		return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+	}
+	return quant(value[0])*19*19 + quant(value[1])*19 + quant(value[2])
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+func sRGBToLinear(value uint32) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func newSolidImage(c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestBlurHash(t *testing.T) {
+	tests := []struct {
+		name   string
+		img    image.Image
+		wantDC string // Average colour
+	}{
+		{"black", newSolidImage(color.Black), encode83(0x000000, 4)},
+		{"white", newSolidImage(color.White), encode83(0xffffff, 4)},
+		{"red", newSolidImage(color.RGBA{255, 0, 0, 255}), encode83(0xff0000, 4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BlurHash(tt.img, 4, 3)
+			// Size flag + maximum AC value + 4 chars for DC + 11 AC components
+			if len(got) != 28 || got[0] != 'L' || got[2:6] != tt.wantDC {
+				t.Errorf("BlurHash() = %v, want DC %v", got, tt.wantDC)
+			}
+		})
+	}
+	// There are no AC components for a black image
+	if got := BlurHash(newSolidImage(color.Black), 4, 3); got != "L00000"+strings.Repeat("fQ", 11) {
+		t.Errorf("BlurHash() = %v", got)
+	}
+}
+
+func TestDominantColor(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 30, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 30; x++ {
+			if x < 20 {
+				img.Set(x, y, color.RGBA{200, 10, 10, 255})
+			} else {
+				img.Set(x, y, color.RGBA{10, 10, 200, 255})
+			}
+		}
+	}
+	if got := DominantColor(img); got != "#c80a0a" {
+		t.Errorf("DominantColor() = %v, want #c80a0a", got)
+	}
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// RotateImage rotates the image clockwise by 0, 90, 180 or 270 degrees
+func RotateImage(img image.Image, degrees int) image.Image {
+	switch ((degrees%360 + 360) % 360) / 90 {
+	case 1:
+		return ApplyOrientation(img, 6)
+	case 2:
+		return ApplyOrientation(img, 3)
+	case 3:
+		return ApplyOrientation(img, 8)
+	}
+	return img
+}
+
+// CropImage crops the image to the given rectangle, relative to the image size (0 to 1)
+func CropImage(img image.Image, x, y, width, height float64) image.Image {
+	b := img.Bounds()
+	rect := image.Rect(
+		b.Min.X+int(math.Round(x*float64(b.Dx()))),
+		b.Min.Y+int(math.Round(y*float64(b.Dy()))),
+		b.Min.X+int(math.Round((x+width)*float64(b.Dx()))),
+		b.Min.Y+int(math.Round((y+height)*float64(b.Dy()))),
+	).Intersect(b)
+	if rect.Empty() {
+		return img
+	}
+	result := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	for py := 0; py < rect.Dy(); py++ {
+		for px := 0; px < rect.Dx(); px++ {
+			result.Set(px, py, img.At(rect.Min.X+px, rect.Min.Y+py))
+		}
+	}
+	return result
+}
+
+// AdjustImage changes brightness and contrast, both between -1 and 1 (0 means no change)
+func AdjustImage(img image.Image, brightness, contrast float64) image.Image {
+	if brightness == 0 && contrast == 0 {
+		return img
+	}
+	// Lookup table for all channel values
+	factor := 1 + contrast
+	if contrast > 0 {
+		// Up to 5x contrast
+		factor = 1 + 4*contrast
+	}
+	lut := [256]uint8{}
+	for i := range lut {
+		v := (float64(i)/255-0.5)*factor + 0.5 + brightness/2
+		lut[i] = uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+	b := img.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			c := color.RGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.RGBA)
+			result.SetRGBA(x, y, color.RGBA{lut[c.R], lut[c.G], lut[c.B], c.A})
+		}
+	}
+	return result
+}
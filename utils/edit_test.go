@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCropImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	img.Set(60, 30, color.White)
+	got := CropImage(img, 0.5, 0.4, 0.5, 0.6)
+	if got.Bounds().Dx() != 50 || got.Bounds().Dy() != 30 {
+		t.Errorf("CropImage() size = %v, want 50x30", got.Bounds().Size())
+	}
+	if r, _, _, _ := got.At(10, 10).RGBA(); r != 0xffff {
+		t.Errorf("CropImage() pixel (10,10) = %v, want white", got.At(10, 10))
+	}
+}
+
+func TestAdjustImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		brightness float64
+		contrast   float64
+		in, want   uint8
+	}{
+		{"none", 0, 0, 100, 100},
+		{"brighter", 0.2, 0, 100, 126},
+		{"darker", -1, 0, 100, 0},
+		{"more contrast", 0, 0.25, 100, 73},
+		{"no contrast", 0, -1, 200, 128},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+			img.Set(0, 0, color.RGBA{tt.in, tt.in, tt.in, 255})
+			got := color.RGBAModel.Convert(AdjustImage(img, tt.brightness, tt.contrast).At(0, 0)).(color.RGBA)
+			if got.R != tt.want {
+				t.Errorf("AdjustImage() = %d, want %d", got.R, tt.want)
+			}
+		})
+	}
+}
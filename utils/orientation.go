@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+)
+
+const (
+	OrientationNormal = 1
+	// Orientations 5 to 8 swap width and height
+	OrientationTranspose = 5
+
+	orientationTag       = 0x0112
+	orientationMaxHeader = 128 * 1024 // The EXIF segment is in the beginning of the file and limited to 64KB
+)
+
+// ReadOrientation returns the EXIF orientation (1 to 8) of a JPEG image, or 1 if there is none.
+// Only the beginning of the reader is consumed
+func ReadOrientation(r io.Reader) int {
+	data, _ := io.ReadAll(io.LimitReader(r, orientationMaxHeader))
+	return jpegOrientation(data)
+}
+
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return OrientationNormal
+	}
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return OrientationNormal
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte
+			pos++
+			continue
+		}
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			// No length for those
+			pos += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			// Start of scan or end of image, no more metadata
+			return OrientationNormal
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return OrientationNormal
+		}
+		segment := data[pos+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			if o := tiffOrientation(segment[6:]); o != 0 {
+				return o
+			}
+		}
+		pos = end
+	}
+	return OrientationNormal
+}
+
+// tiffOrientation looks for the orientation tag in IFD0, returns 0 if not found
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == orientationTag {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 0
+			}
+			return o
+		}
+	}
+	return 0
+}
+
+// ApplyOrientation transforms the image so it's upright, based on the EXIF orientation
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= OrientationNormal || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= OrientationTranspose {
+		dw, dh = h, w
+	}
+	result := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// Source coordinates for the current destination pixel
+			sx, sy := x, y
+			switch orientation {
+			case 2: // Flip horizontally
+				sx, sy = w-1-x, y
+			case 3: // Rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // Flip vertically
+				sx, sy = x, h-1-y
+			case 5: // Transpose
+				sx, sy = y, x
+			case 6: // Rotate 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // Transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // Rotate 90 counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			result.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return result
+}
+
+// DecodeImage decodes the image and applies its EXIF orientation (if any)
+func DecodeImage(r io.Reader) (image.Image, int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, OrientationNormal, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, OrientationNormal, err
+	}
+	orientation := jpegOrientation(data)
+	return ApplyOrientation(img, orientation), orientation, nil
+}
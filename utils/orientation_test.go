@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+const orientationBlock = 16 // Block size in pixels, big enough to survive JPEG compression
+
+var orientationColors = []color.RGBA{
+	{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255},
+	{255, 255, 255, 255}, {0, 0, 0, 255}, {255, 255, 0, 255},
+}
+
+// newOrientationJPEG creates a 3x2 blocks image (colours 0 to 5, row by row) with the given EXIF orientation
+func newOrientationJPEG(t *testing.T, orientation int, order binary.ByteOrder) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 3*orientationBlock, 2*orientationBlock))
+	for y := 0; y < 2*orientationBlock; y++ {
+		for x := 0; x < 3*orientationBlock; x++ {
+			img.Set(x, y, orientationColors[(y/orientationBlock)*3+x/orientationBlock])
+		}
+	}
+	buf := bytes.Buffer{}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	// TIFF header and IFD0 with the orientation tag only
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], orientationTag)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	data := buf.Bytes()
+	result := append([]byte{}, data[:2]...)
+	result = append(result, app1...)
+	result = append(result, segment...)
+	return append(result, data[2:]...)
+}
+
+func TestDecodeImageOrientation(t *testing.T) {
+	// Golden layouts (colour indexes, row by row) of the image as it should be displayed
+	golden := map[int][][]int{
+		1: {{0, 1, 2}, {3, 4, 5}},
+		2: {{2, 1, 0}, {5, 4, 3}},
+		3: {{5, 4, 3}, {2, 1, 0}},
+		4: {{3, 4, 5}, {0, 1, 2}},
+		5: {{0, 3}, {1, 4}, {2, 5}},
+		6: {{3, 0}, {4, 1}, {5, 2}},
+		7: {{5, 2}, {4, 1}, {3, 0}},
+		8: {{2, 5}, {1, 4}, {0, 3}},
+	}
+	for orientation, want := range golden {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			data := newOrientationJPEG(t, orientation, order)
+			if got := ReadOrientation(bytes.NewReader(data)); got != orientation {
+				t.Errorf("ReadOrientation() = %d, want %d (%v)", got, orientation, order)
+			}
+			img, got, err := DecodeImage(bytes.NewReader(data))
+			if err != nil || got != orientation {
+				t.Fatalf("DecodeImage() orientation = %d, err = %v, want %d", got, err, orientation)
+			}
+			b := img.Bounds()
+			if b.Dx() != len(want[0])*orientationBlock || b.Dy() != len(want)*orientationBlock {
+				t.Errorf("orientation %d: size = %v, want %dx%d blocks", orientation, b.Size(), len(want[0]), len(want))
+				continue
+			}
+			for row, indexes := range want {
+				for col, index := range indexes {
+					// Sample the centre of each block
+					r, g, bl, _ := img.At(b.Min.X+col*orientationBlock+orientationBlock/2, b.Min.Y+row*orientationBlock+orientationBlock/2).RGBA()
+					c := orientationColors[index]
+					if absDiff(r>>8, uint32(c.R)) > 16 || absDiff(g>>8, uint32(c.G)) > 16 || absDiff(bl>>8, uint32(c.B)) > 16 {
+						t.Errorf("orientation %d: block (%d,%d) = %d,%d,%d, want colour %d", orientation, col, row, r>>8, g>>8, bl>>8, index)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestReadOrientationWithoutExif(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("not an image"), {0xFF, 0xD8, 0xFF, 0xDA, 0, 2}} {
+		if got := ReadOrientation(bytes.NewReader(data)); got != OrientationNormal {
+			t.Errorf("ReadOrientation(%v) = %d, want 1", data, got)
+		}
+	}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
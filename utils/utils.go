@@ -16,6 +16,7 @@ import (
 	"math/big"
 	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"github.com/nfnt/resize"
 )
@@ -44,6 +45,28 @@ func ByteArrayToFloat32Array(b []byte) (result []float32) {
 	return
 }
 
+// DistanceSq returns the squared euclidean distance between two vectors of the same size (e.g. face descriptors)
+func DistanceSq(a, b []float32) float64 {
+	var s0, s1, s2, s3 float32
+	i := 0
+	// Four independent sums, so the compiler can keep them in registers
+	for ; i+4 <= len(a); i += 4 {
+		d0 := a[i] - b[i]
+		d1 := a[i+1] - b[i+1]
+		d2 := a[i+2] - b[i+2]
+		d3 := a[i+3] - b[i+3]
+		s0 += d0 * d0
+		s1 += d1 * d1
+		s2 += d2 * d2
+		s3 += d3 * d3
+	}
+	for ; i < len(a); i++ {
+		d := a[i] - b[i]
+		s0 += d * d
+	}
+	return float64(s0 + s1 + s2 + s3)
+}
+
 func GetSeason(month time.Month, gpsLat *float64) string {
 	if gpsLat == nil {
 		return ""
@@ -111,20 +134,20 @@ type ImageThumbConverted struct {
 }
 
 func CreateThumb(size uint, reader io.Reader, writer io.Writer) (result ImageThumbConverted, err error) {
-	image, _, err := image.Decode(reader)
+	img, _, err := DecodeImage(reader)
 	if err != nil {
 		return result, err
 	}
 	var newBuf bytes.Buffer
-	newImage := resize.Thumbnail(size, size, image, resize.Lanczos3)
-	if err = jpeg.Encode(&newBuf, newImage, &jpeg.Options{Quality: 90}); err != nil {
+	newImage := resize.Thumbnail(size, size, img, resize.Lanczos3)
+	if err = EncodeJPEG(&newBuf, newImage); err != nil {
 		return
 	}
 	imageRect := newImage.Bounds().Size()
 	result.NewX = uint16(imageRect.X)
 	result.NewY = uint16(imageRect.Y)
 
-	imageRect = image.Bounds().Size()
+	imageRect = img.Bounds().Size()
 	result.OldX = uint16(imageRect.X)
 	result.OldY = uint16(imageRect.Y)
 
@@ -132,6 +155,11 @@ func CreateThumb(size uint, reader io.Reader, writer io.Writer) (result ImageThu
 	return
 }
 
+// EncodeJPEG uses the same quality for all generated images
+func EncodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+}
+
 func StringToFloat64Ptr(in string) *float64 {
 	f, _ := strconv.ParseFloat(in, 64)
 	return &f
@@ -141,3 +169,14 @@ func StringToUInt16(in string) uint16 {
 	i, _ := strconv.ParseUint(in, 10, 16)
 	return uint16(i)
 }
+
+// TruncateString cuts s to at most maxBytes, without splitting a UTF-8 character
+func TruncateString(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
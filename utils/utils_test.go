@@ -0,0 +1,24 @@
+package utils
+
+import "testing"
+
+func TestTruncateString(t *testing.T) {
+	tests := []struct {
+		s        string
+		maxBytes int
+		want     string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"abcdef", 3, "abc"},
+		{"añb", 2, "a"},
+		{"añb", 3, "añ"},
+		{"日本", 4, "日"},
+		{"日本", 2, ""},
+	}
+	for _, tt := range tests {
+		if got := TruncateString(tt.s, tt.maxBytes); got != tt.want {
+			t.Errorf("TruncateString(%q, %d) = %q, want %q", tt.s, tt.maxBytes, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"server/db"
 	"server/handlers"
+	"server/models"
 	"server/utils"
 
 	"github.com/gin-gonic/gin"
@@ -92,7 +93,10 @@ func AlbumView(c *gin.Context) {
 	if heroAssetID != nil {
 		json["heroAssetID"] = *heroAssetID
 	} else if len(*result) > 0 {
-		json["heroAssetID"] = (*result)[0].ID
+		json["heroAssetID"] = handlers.BestAssetID(db.Instance.
+			Table("album_assets").
+			Joins("join assets on album_assets.asset_id = assets.id").
+			Where("album_assets.album_id = ? and assets.deleted=0", albumId), (*result)[0].ID)
 	}
 	if c.Query("format") == "json" {
 		c.JSON(http.StatusOK, json)
@@ -135,3 +139,55 @@ func AlbumAssetView(c *gin.Context) {
 	// Return the asset
 	handlers.RealAssetFetch(c, 0)
 }
+
+// AlbumFaceView returns the crop of a face in one of the shared album's assets
+func AlbumFaceView(c *gin.Context) {
+	token := c.Param("token")
+	r := handlers.FaceCropRequest{}
+	if err := c.ShouldBindQuery(&r); err != nil {
+		c.JSON(http.StatusBadRequest, handlers.Response{Error: err.Error()})
+		return
+	}
+	var count int64
+	err := db.Instance.Table("album_shares").
+		Joins("join album_assets on album_shares.album_id = album_assets.album_id").
+		Joins("join faces on faces.asset_id = album_assets.asset_id").
+		Where("token = ? and faces.id = ? and "+
+			"(expires_at is null or expires_at=0 or expires_at>"+db.TimestampFunc+")", token, r.ID).
+		Count(&count).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, handlers.DBError1Response)
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, handlers.NopeResponse)
+		return
+	}
+	handlers.RealFaceCrop(c, 0)
+}
+
+// AlbumMapView returns the shared album's geotagged assets, clustered for the map view.
+// Nothing is returned if the locations are hidden (with the originals)
+func AlbumMapView(c *gin.Context) {
+	token := c.Param("token")
+	share := models.AlbumShare{}
+	err := db.Instance.
+		Where("token = ? and (expires_at is null or expires_at=0 or expires_at>"+db.TimestampFunc+")", token).
+		Find(&share).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, handlers.DBError1Response)
+		return
+	}
+	if share.AlbumID == 0 {
+		c.JSON(http.StatusNotFound, handlers.NopeResponse)
+		return
+	}
+	if share.HideOriginal > 0 {
+		c.JSON(http.StatusOK, handlers.MapResponse{Type: "FeatureCollection", Features: []handlers.MapFeature{}})
+		return
+	}
+	handlers.RealMapClusters(c, db.Instance.
+		Table("album_assets").
+		Joins("join assets on album_assets.asset_id = assets.id").
+		Where("album_assets.album_id = ?", share.AlbumID))
+}